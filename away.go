@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Away ──
+// /away and /back, auto-away after /set autoaway minutes without input,
+// and per-user away state from away-notify, WHO flags and 301 replies.
+
+const autoAwayMsg = "Auto-away (idle)"
+
+func (s *Session) cmdAway(arg string) {
+	msg := strings.TrimSpace(arg)
+	if msg == "" {
+		msg = "Away"
+	}
+	s.mu.Lock()
+	s.autoAway = false
+	s.mu.Unlock()
+	s.ircSend("AWAY :" + msg)
+}
+
+func (s *Session) cmdBack() {
+	s.mu.Lock()
+	s.autoAway = false
+	s.mu.Unlock()
+	s.ircSend("AWAY")
+}
+
+// selfAway handles 305 RPL_UNAWAY / 306 RPL_NOWAWAY. (call without mu held)
+func (s *Session) selfAway(m ircMsg) {
+	s.mu.Lock()
+	s.away = m.command == "306"
+	if s.away {
+		s.activeChan().addMsg(s.fmtMsg(fgGrey + "You are now marked as away" + rst))
+	} else {
+		s.autoAway = false
+		s.activeChan().addMsg(s.fmtMsg(fgGrey + "You are no longer marked as away" + rst))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// userAway records an away-notify AWAY from someone. (call without mu held)
+func (s *Session) userAway(m ircMsg) {
+	s.mu.Lock()
+	if u := s.user(m.nick()); u != nil {
+		u.away = len(m.params) > 0
+		u.awayMsg = ""
+		if u.away {
+			u.awayMsg = m.trail()
+		}
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// awayReply handles a 301 RPL_AWAY that isn't part of a WHOIS: the answer
+// to messaging someone who is away. Each message is shown once.
+// (call without mu held)
+func (s *Session) awayReply(m ircMsg) {
+	if len(m.params) < 3 {
+		return
+	}
+	nick, msg := m.params[1], m.trail()
+	s.mu.Lock()
+	u := s.user(nick)
+	if u == nil {
+		u = &ircUser{nick: nick}
+		s.users[strings.ToLower(nick)] = u
+	}
+	u.away, u.awayMsg = true, msg
+	if u.awayShown != msg {
+		u.awayShown = msg
+		c := s.getChan(nick)
+		if c == nil {
+			c = s.activeChan()
+		}
+		s.addMsgTo(c, s.fmtMsg(nickColor(nick)+"%s"+rst+fgGrey+" is away: "+rst+"%s", nick, msg))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// awayNicks returns the display names in c.nicks that are known to be
+// away. (call with mu held)
+func (s *Session) awayNicks(c *Channel) map[string]bool {
+	away := make(map[string]bool)
+	for low, d := range c.nicks {
+		if u := s.users[low]; u != nil && u.away {
+			away[d] = true
+		}
+	}
+	return away
+}
+
+// idle is called for every line the client types; it ends an auto-away.
+// (call without mu held)
+func (s *Session) idle() {
+	s.mu.Lock()
+	s.lastInput = time.Now()
+	back := s.autoAway
+	s.autoAway = false
+	s.mu.Unlock()
+	if back {
+		s.ircSend("AWAY")
+	}
+}
+
+// autoAwayLoop marks the user away after /set autoaway minutes without
+// input. (call without mu held)
+func (s *Session) autoAwayLoop(quit <-chan struct{}) {
+	t := time.NewTicker(30 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		due := s.autoAwayMins > 0 && !s.away && !s.autoAway && s.registered &&
+			time.Since(s.lastInput) >= time.Duration(s.autoAwayMins)*time.Minute
+		if due {
+			s.autoAway = true
+		}
+		s.mu.Unlock()
+		if due {
+			s.ircSend("AWAY :" + autoAwayMsg)
+		}
+	}
+}
+
+func autoAwaySet(s *Session, v string) error {
+	if v == "off" {
+		v = "0"
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return errors.New("expected minutes, or 0/off")
+	}
+	s.autoAwayMins = n
+	return nil
+}
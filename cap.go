@@ -0,0 +1,76 @@
+package main
+
+import "strings"
+
+// ── IRCv3 capabilities ──
+// CAP LS 302 goes out before NICK/USER; whatever we support is requested
+// and registration resumes with CAP END. Servers without CAP answer 421
+// and register us as usual.
+
+var capsWanted = []string{"away-notify"}
+
+// capMsg handles one CAP reply. (call without mu held)
+func (s *Session) capMsg(m ircMsg) {
+	// * LS [*] :caps
+	if len(m.params) < 3 {
+		return
+	}
+	sub := strings.ToUpper(m.params[1])
+	more := len(m.params) >= 4 && m.params[2] == "*"
+	list := strings.Fields(m.trail())
+
+	s.mu.Lock()
+	switch sub {
+	case "LS":
+		for _, c := range list {
+			name, _, _ := strings.Cut(c, "=")
+			s.capLS = append(s.capLS, name)
+		}
+		if more {
+			s.mu.Unlock()
+			return
+		}
+		var req []string
+		for _, want := range capsWanted {
+			for _, have := range s.capLS {
+				if have == want {
+					req = append(req, want)
+				}
+			}
+		}
+		s.capLS = nil
+		s.mu.Unlock()
+		if len(req) > 0 {
+			s.ircSend("CAP REQ :" + strings.Join(req, " "))
+		} else {
+			s.ircSend("CAP END")
+		}
+		return
+	case "ACK":
+		for _, c := range list {
+			if strings.HasPrefix(c, "-") {
+				delete(s.caps, c[1:])
+			} else {
+				s.caps[c] = true
+			}
+		}
+	case "NAK":
+	case "DEL":
+		for _, c := range list {
+			delete(s.caps, c)
+		}
+	default:
+		s.mu.Unlock()
+		return
+	}
+	registered := s.registered
+	s.mu.Unlock()
+	if (sub == "ACK" || sub == "NAK") && !registered {
+		s.ircSend("CAP END")
+	}
+}
+
+// hasCap reports whether a capability was acknowledged. (call with mu held)
+func (s *Session) hasCap(name string) bool {
+	return s.caps[name]
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── CTCP ──
+// Requests arrive as PRIVMSG "\x01CMD args\x01", replies as NOTICE in the
+// same framing. ACTION is handled with normal messages.
+
+const (
+	ctcpSource  = "https://github.com/acidvegas/irctun"
+	ctcpVersion = "irctun (telnet IRC tunnel) - " + ctcpSource
+	ctcpBurst   = 3                // replies allowed per window
+	ctcpWindow  = 10 * time.Second // so a CTCP flood can't get us killed
+)
+
+var ctcpSupported = []string{"ACTION", "CLIENTINFO", "PING", "SOURCE", "TIME", "VERSION"}
+
+// parseCTCP splits a CTCP message into command and arguments. The closing
+// \x01 is optional, some clients drop it.
+func parseCTCP(msg string) (cmd, args string, ok bool) {
+	if len(msg) < 2 || msg[0] != '\x01' {
+		return "", "", false
+	}
+	body := strings.TrimSuffix(msg[1:], "\x01")
+	cmd, args, _ = strings.Cut(body, " ")
+	return strings.ToUpper(cmd), args, cmd != ""
+}
+
+// ctcpAllowed applies the reply rate limit. (call with mu held)
+func (s *Session) ctcpAllowed() bool {
+	now := time.Now()
+	keep := s.ctcpTimes[:0]
+	for _, t := range s.ctcpTimes {
+		if now.Sub(t) < ctcpWindow {
+			keep = append(keep, t)
+		}
+	}
+	s.ctcpTimes = keep
+	if len(keep) >= ctcpBurst {
+		return false
+	}
+	s.ctcpTimes = append(s.ctcpTimes, now)
+	return true
+}
+
+// handleCTCP answers a CTCP request from sender. (call without mu held)
+func (s *Session) handleCTCP(sender, target, cmd, args string) {
+	reply := ""
+	switch cmd {
+	case "VERSION":
+		reply = ctcpVersion
+	case "PING":
+		reply = args
+	case "TIME":
+		reply = time.Now().Format(time.RFC1123Z)
+	case "CLIENTINFO":
+		reply = strings.Join(ctcpSupported, " ")
+	case "SOURCE":
+		reply = ctcpSource
+	}
+	known := cmd == "PING" || reply != ""
+
+	// A flood is dropped silently: past the rate limit nothing is shown
+	// or answered
+	s.mu.Lock()
+	allowed := s.ctcpAllowed()
+	if allowed {
+		where := ""
+		if strings.HasPrefix(target, "#") {
+			where = " (" + target + ")"
+		}
+		s.activeChan().addMsg(s.fmtMsg(fgGrey+"CTCP "+fgWhite+"%s"+fgGrey+" from "+rst+nickColor(sender)+"%s"+rst+fgGrey+"%s"+rst, cmd, sender, where))
+	}
+	s.mu.Unlock()
+	if !allowed {
+		return
+	}
+	s.draw()
+
+	if known {
+		if reply != "" {
+			reply = " " + reply
+		}
+		s.ircSend(fmt.Sprintf("NOTICE %s :\x01%s%s\x01", sender, cmd, reply))
+	}
+}
+
+// ctcpReply shows a CTCP reply, with the round trip for our own PINGs.
+// (call without mu held)
+func (s *Session) ctcpReply(sender, cmd, args string) {
+	text := args
+	if cmd == "PING" {
+		if sent, err := strconv.ParseInt(args, 10, 64); err == nil {
+			rtt := time.Since(time.UnixMilli(sent))
+			text = fmt.Sprintf("%.3fs", rtt.Seconds())
+		}
+	}
+	s.mu.Lock()
+	s.activeChan().addMsg(s.fmtMsg(fgGrey+"CTCP "+fgWhite+"%s"+fgGrey+" reply from "+rst+nickColor(sender)+"%s"+rst+fgGrey+": "+rst+"%s", cmd, sender, text))
+	s.mu.Unlock()
+	s.draw()
+}
+
+// cmdCTCP implements /ctcp <nick> <cmd> [args] and /ping <nick>.
+func (s *Session) cmdCTCP(arg string) {
+	f := strings.SplitN(arg, " ", 3)
+	if len(f) < 2 || f[0] == "" || f[1] == "" {
+		s.mu.Lock()
+		s.activeChan().addMsg(s.fmtMsg(fgGrey + "Usage: /ctcp <nick> <command> [args]" + rst))
+		s.mu.Unlock()
+		s.draw()
+		return
+	}
+	target, cmd := f[0], strings.ToUpper(f[1])
+	args := ""
+	if len(f) == 3 {
+		args = f[2]
+	}
+	if cmd == "PING" && args == "" {
+		args = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	}
+	if args != "" {
+		args = " " + args
+	}
+	s.ircSend(fmt.Sprintf("PRIVMSG %s :\x01%s%s\x01", target, cmd, args))
+	s.mu.Lock()
+	s.activeChan().addMsg(s.fmtMsg(fgGrey+"CTCP "+fgWhite+"%s"+fgGrey+" sent to "+rst+"%s", cmd, target))
+	s.mu.Unlock()
+	s.draw()
+}
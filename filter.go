@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Join/part noise ──
+// Join/part/quit/nick lines of users who haven't spoken in the last
+// /set smartdelay minutes are dropped with /set smartfilter on, so they
+// don't push chat out of the buffer. With it off they're kept, marked with
+// roleHidden, and hidden if it's turned on later. With /set collapse,
+// consecutive events merge into one summary line. /filter overrides both
+// per channel.
+
+const maxRunNames = 8 // names listed per kind in a collapsed run
+
+// eventRun is the collapsed summary line being extended.
+type eventRun struct {
+	text  string              // current line, to find it again
+	kinds []string            // "joined", "left", "quit", "nick", in first-seen order
+	names map[string][]string // per kind
+}
+
+func (r *eventRun) render() string {
+	var parts []string
+	for _, k := range r.kinds {
+		names := r.names[k]
+		list := strings.Join(names[:min(len(names), maxRunNames)], ", ")
+		if len(names) > maxRunNames {
+			list += fmt.Sprintf(" +%d more", len(names)-maxRunNames)
+		}
+		switch k {
+		case "joined":
+			parts = append(parts, "→ "+list+" joined")
+		case "nick":
+			parts = append(parts, list)
+		default:
+			parts = append(parts, "← "+list+" "+k)
+		}
+	}
+	return strings.Join(parts, " │ ")
+}
+
+// smartOn reports whether c's join/part noise is filtered. (call with mu held)
+func (s *Session) smartOn(c *Channel) bool {
+	if c.smart != nil {
+		return *c.smart
+	}
+	return s.smart
+}
+
+// collapseOn reports whether c's events merge into runs. (call with mu held)
+func (s *Session) collapseOn(c *Channel) bool {
+	if c.collapse != nil {
+		return *c.collapse
+	}
+	return s.collapse
+}
+
+// spoke records that nick talked in c, forgetting those quiet for longer
+// than smartdelay now and then. (call with mu held)
+func (s *Session) spoke(c *Channel, nick string) {
+	if c.lastSpoke == nil {
+		c.lastSpoke = make(map[string]time.Time)
+	}
+	now := time.Now()
+	c.lastSpoke[strings.ToLower(nick)] = now
+	if now.Sub(c.spokeGC) < time.Minute {
+		return
+	}
+	c.spokeGC = now
+	for n, t := range c.lastSpoke {
+		if now.Sub(t) > time.Duration(s.smartMins)*time.Minute {
+			delete(c.lastSpoke, n)
+		}
+	}
+}
+
+// eventLine adds a join/part/quit/nick line for nick to c, hidden,
+// collapsed or as is. kind is "joined", "left", "quit" or "nick"; name is
+// what a collapsed run lists. (call with mu held)
+func (s *Session) eventLine(c *Channel, nick, kind, name, line string) {
+	run := c.run
+	if t, ok := c.lastSpoke[strings.ToLower(nick)]; !ok || time.Since(t) > time.Duration(s.smartMins)*time.Minute {
+		if s.smartOn(c) {
+			return
+		}
+		line = roleHidden + line // hidden if the filter is turned on
+	}
+	if !s.collapseOn(c) {
+		s.addMsgTo(c, line)
+		return
+	}
+	if run != nil {
+		if run.names[kind] == nil {
+			run.kinds = append(run.kinds, kind)
+		}
+		run.names[kind] = append(run.names[kind], name)
+		next := s.fmtMsg(roleJoin+"%s"+rst, run.render())
+		if c.replaceMsg(run.text, next) {
+			run.text = next
+			c.run = run
+			return
+		}
+	}
+	run = &eventRun{kinds: []string{kind}, names: map[string][]string{kind: {name}}}
+	run.text = s.fmtMsg(roleJoin+"%s"+rst, run.render())
+	s.addMsgTo(c, run.text)
+	c.run = run
+}
+
+// visibleCount is the number of c's lines shown. (call with mu held)
+func (s *Session) visibleCount(c *Channel) int {
+	if s.smartOn(c) {
+		return len(c.msgs) - c.hidden
+	}
+	return len(c.msgs)
+}
+
+// visibleTail copies the last n lines of c as shown, walking back only as
+// far as it needs to. (call with mu held)
+func (s *Session) visibleTail(c *Channel, n int) []string {
+	hide := s.smartOn(c) && c.hidden > 0
+	out := make([]string, min(n, len(c.msgs)))
+	i := len(out)
+	for j := len(c.msgs) - 1; j >= 0 && i > 0; j-- {
+		if !hide || !strings.HasPrefix(c.msgs[j], roleHidden) {
+			i--
+			out[i] = c.msgs[j]
+		}
+	}
+	return out[i:]
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func parseOnOff(v string) (bool, error) {
+	switch v {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, errors.New("expected on or off")
+}
+
+func smartDelaySet(s *Session, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return errors.New("expected minutes")
+	}
+	s.smartMins = n
+	return nil
+}
+
+// cmdFilter shows or overrides the filters for the active channel:
+// /filter [smart|collapse] [on|off|default]
+func (s *Session) cmdFilter(arg string) {
+	f := strings.Fields(strings.ToLower(arg))
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	c := s.activeChan()
+	if len(f) == 2 && (f[0] == "smart" || f[0] == "collapse") {
+		var val *bool
+		switch f[1] {
+		case "on", "off":
+			b := f[1] == "on"
+			val = &b
+		case "default":
+		default:
+			f = nil
+		}
+		if f != nil {
+			if f[0] == "smart" {
+				c.smart = val
+			} else {
+				c.collapse = val
+				c.run = nil
+			}
+		}
+	} else if len(f) > 0 {
+		f = nil
+	}
+	if f == nil {
+		c.addMsg(s.fmtMsg(fgGrey + "Usage: /filter [smart|collapse] [on|off|default]" + rst))
+		return
+	}
+	c.addMsg(s.fmtMsg(fgGrey+"%s: smart filter "+rst+"%s"+fgGrey+" (%d hidden), collapse "+rst+"%s",
+		c.name, onOff(s.smartOn(c)), c.hidden, onOff(s.collapseOn(c))))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── Flood control ──
+// Everything sent to IRC goes through a per-session token bucket drained by
+// a single writer goroutine. PONG and registration lines skip the wait so a
+// long paste can't get the user pinged out.
+
+var (
+	floodBurst = flag.Int("burst", 5, "IRC lines sent back to back before pacing kicks in")
+	floodRate  = flag.Duration("rate", 2*time.Second, "interval between paced IRC lines")
+)
+
+type sendQueue struct {
+	mu       sync.Mutex
+	urgent   []string
+	lines    []string
+	tokens   float64
+	last     time.Time
+	stopping bool
+	regDone  bool // 001 seen, registration commands are paced again
+	wake     chan struct{}
+	done     chan struct{}
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		tokens: float64(*floodBurst),
+		last:   time.Now(),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (q *sendQueue) push(line string) {
+	q.mu.Lock()
+	if urgentLine(line, q.regDone) {
+		q.urgent = append(q.urgent, line)
+	} else {
+		q.lines = append(q.lines, line)
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) registered() {
+	q.mu.Lock()
+	q.regDone = true
+	q.mu.Unlock()
+}
+
+// pending returns the number of lines waiting for a token.
+func (q *sendQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.lines)
+}
+
+// refill adds the tokens earned since the last call. (call with q.mu held)
+func (q *sendQueue) refill() {
+	now := time.Now()
+	q.tokens += float64(now.Sub(q.last)) / float64(*floodRate)
+	if burst := float64(*floodBurst); q.tokens > burst {
+		q.tokens = burst
+	}
+	q.last = now
+}
+
+// next blocks until a line may be sent. ok is false once the queue is
+// stopped and the urgent lines are flushed.
+func (q *sendQueue) next() (line string, ok bool) {
+	for {
+		q.mu.Lock()
+		q.refill()
+		if len(q.urgent) > 0 {
+			line = q.urgent[0]
+			q.urgent = q.urgent[1:]
+			if q.tokens >= 1 {
+				q.tokens--
+			}
+			q.mu.Unlock()
+			return line, true
+		}
+		if q.stopping {
+			q.mu.Unlock()
+			return "", false
+		}
+		var wait <-chan time.Time
+		if len(q.lines) > 0 {
+			if q.tokens >= 1 {
+				line = q.lines[0]
+				q.lines = q.lines[1:]
+				q.tokens--
+				q.mu.Unlock()
+				return line, true
+			}
+			wait = time.After(time.Duration((1 - q.tokens) * float64(*floodRate)))
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.wake:
+		case <-wait:
+		}
+	}
+}
+
+// stop flushes any urgent lines (e.g. QUIT), drops the rest and waits for
+// the writer to exit.
+func (q *sendQueue) stop() {
+	q.mu.Lock()
+	q.stopping = true
+	q.lines = nil
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	select {
+	case <-q.done:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// ircWriter is the only goroutine that writes to the IRC connection.
+func (s *Session) ircWriter() {
+	defer close(s.sendq.done)
+	for {
+		line, ok := s.sendq.next()
+		if !ok {
+			return
+		}
+		s.irc.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		s.irc.Write([]byte(line + "\r\n"))
+		s.logRaw(line, true)
+		s.draw() // queued count in the status bar
+	}
+}
+
+// urgentLine reports whether line should bypass pacing.
+func urgentLine(line string, registered bool) bool {
+	cmd := line
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		cmd = line[:i]
+	}
+	switch strings.ToUpper(cmd) {
+	case "PONG", "QUIT":
+		return true
+	case "NICK", "USER", "PASS", "CAP", "AUTHENTICATE":
+		return !registered
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ── Highlights ──
+// A line highlights when it mentions our nick or a /set hlwords entry as a
+// whole word, compared under the server's CASEMAPPING, unless it also
+// matches /set hlexclude. Entries written as /regex/ are regular
+// expressions instead.
+
+type hlPattern struct {
+	src  string
+	word string         // folded word, matched on word boundaries
+	re   *regexp.Regexp // or a case-insensitive regex
+}
+
+var (
+	rfc1459Fold       = strings.NewReplacer("[", "{", "]", "}", "\\", "|", "~", "^")
+	strictRfc1459Fold = strings.NewReplacer("[", "{", "]", "}", "\\", "|")
+)
+
+// fold lowercases str the way the server compares nicks. (call with mu held)
+func (s *Session) fold(str string) string {
+	str = strings.ToLower(str)
+	cm, _ := s.support("CASEMAPPING")
+	switch strings.ToLower(cm) {
+	case "ascii":
+		return str
+	case "strict-rfc1459":
+		return strictRfc1459Fold.Replace(str)
+	}
+	return rfc1459Fold.Replace(str) // the default when not advertised
+}
+
+// isWordRune reports whether r can be part of a nick or word, so a match
+// next to it isn't on a boundary.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("[]\\`_^{|}-", r)
+}
+
+// containsWord finds word in text (both folded) with a boundary each side.
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	for off := 0; ; {
+		i := strings.Index(text[off:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := off+i, off+i+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		off = start + 1
+	}
+}
+
+// splitPatterns splits a /set value on commas, except inside a /regex/
+// entry, which runs to a closing slash followed by a comma or the end.
+func splitPatterns(v string) []string {
+	var out []string
+	for {
+		v = strings.TrimLeft(v, " ")
+		end := strings.IndexByte(v, ',')
+		if strings.HasPrefix(v, "/") {
+			for i := 1; i < len(v); i++ {
+				if v[i] == '\\' {
+					i++
+					continue
+				}
+				if rest := strings.TrimLeft(v[i+1:], " "); v[i] == '/' && (rest == "" || rest[0] == ',') {
+					end = len(v) - len(rest)
+					if rest == "" {
+						end = -1
+					}
+					break
+				}
+			}
+		}
+		if end < 0 {
+			return append(out, v)
+		}
+		out = append(out, v[:end])
+		v = v[end+1:]
+	}
+}
+
+// parsePatterns turns a comma-separated /set value into patterns.
+// (call with mu held)
+func (s *Session) parsePatterns(v string) ([]hlPattern, error) {
+	var out []hlPattern
+	for _, p := range splitPatterns(v) {
+		p = strings.TrimSpace(p)
+		if p == "" || p == "-" {
+			continue
+		}
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile("(?i)" + p[1:len(p)-1])
+			if err != nil {
+				return nil, errors.New("bad regex " + p + ": " + err.Error())
+			}
+			out = append(out, hlPattern{src: p, re: re})
+			continue
+		}
+		out = append(out, hlPattern{src: p, word: s.fold(p)})
+	}
+	return out, nil
+}
+
+func patternsString(ps []hlPattern) string {
+	srcs := make([]string, len(ps))
+	for i, p := range ps {
+		srcs[i] = p.src
+	}
+	return strings.Join(srcs, ",")
+}
+
+// matchAny reports whether msg (and its folded form) hits any pattern.
+func matchAny(ps []hlPattern, msg, folded string) bool {
+	for _, p := range ps {
+		if p.re != nil && p.re.MatchString(msg) || p.re == nil && containsWord(folded, p.word) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlights reports whether a message from someone else mentions us.
+// (call with mu held)
+func (s *Session) highlights(msg string) bool {
+	folded := s.fold(msg)
+	if !containsWord(folded, s.fold(s.nick)) && !matchAny(s.hlWords, msg, folded) {
+		return false
+	}
+	return !matchAny(s.hlExclude, msg, folded)
+}
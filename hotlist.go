@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Hotlist ──
+// Unread messages (PRIVMSG, NOTICE, ACTION) and highlights per window, shown
+// right after the window name in the status bar as
+// [Act: 2:#foo(3),4:bob(1)]; /next (or Alt-A + Enter) jumps to the most
+// important one: highlights first, then private messages, then channels.
+
+// hotPriority ranks a window for /next; 0 means nothing to see.
+// (call with mu held)
+func hotPriority(c *Channel) int {
+	switch {
+	case c.highlight > 0:
+		return 3
+	case c.unread == 0 || strings.HasPrefix(c.name, "*"):
+		return 0
+	case !strings.HasPrefix(c.name, "#"):
+		return 2
+	}
+	return 1
+}
+
+// hotlist renders the status bar entry, or "" with no activity. Window
+// names starting with * only show when they hold a highlight.
+// (call with mu held)
+func (s *Session) hotlist(th *Theme) string {
+	var parts []string
+	for i, c := range s.channels {
+		if i == s.active || hotPriority(c) == 0 {
+			continue
+		}
+		entry := fmt.Sprintf("%d:%s(%d)", i, c.name, c.unread)
+		if c.highlight > 0 {
+			entry = rst + th.highlight + entry + rst + th.status
+		}
+		parts = append(parts, entry)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[Act: " + strings.Join(parts, ",") + "]"
+}
+
+// cmdNext switches to the most important window with activity.
+func (s *Session) cmdNext() {
+	s.mu.Lock()
+	best, bestPri := -1, 0
+	for i, c := range s.channels {
+		if p := hotPriority(c); i != s.active && p > bestPri {
+			best, bestPri = i, p
+		}
+	}
+	if best < 0 {
+		s.activeChan().addMsg(s.fmtMsg(fgGrey + "No activity" + rst))
+	} else {
+		s.switchToIdx(best)
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// altA strips an Alt-A (ESC a) from a typed line and reports whether it
+// was there.
+func altA(line string) (string, bool) {
+	for _, k := range []string{"\x1ba", "\x1bA"} {
+		if strings.Contains(line, k) {
+			return strings.ReplaceAll(line, k, ""), true
+		}
+	}
+	return line, false
+}
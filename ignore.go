@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ── Ignore list ──
+// /ignore <mask> [types] [-t duration] silences nick!user@host patterns per
+// message type. Lines are dropped in the IRC reader before they reach any
+// window; join/part/quit/nick still update the nicklist. With -data set the
+// list is saved per services account and loaded again on login.
+
+var dataDir = flag.String("data", "", "directory for per-account data such as ignore lists (empty = don't persist)")
+
+var ignoreTypes = []string{"msgs", "notices", "ctcps", "joins", "nicks", "invites"}
+
+type ignoreEntry struct {
+	Mask    string    `json:"mask"`
+	Types   []string  `json:"types"` // empty = everything
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e *ignoreEntry) covers(kind string) bool {
+	if len(e.Types) == 0 {
+		return true
+	}
+	for _, t := range e.Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ignoreEntry) expired() bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// wildMatch matches s against a glob with * and ?, case-insensitively.
+func wildMatch(pattern, s string) bool {
+	p, str := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(s))
+	pi, si, star, mark := 0, 0, -1, 0
+	for si < len(str) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == str[si]):
+			pi++
+			si++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// normalMask turns a bare nick or user@host into a full nick!user@host mask.
+func normalMask(m string) string {
+	if !strings.ContainsAny(m, "!@") {
+		return m + "!*@*"
+	}
+	if !strings.Contains(m, "!") {
+		return "*!" + m
+	}
+	if !strings.Contains(m, "@") {
+		return m + "@*"
+	}
+	return m
+}
+
+// ignoreKind names the ignore type a message falls under, or "". A /me is
+// a message, not a CTCP.
+func ignoreKind(m ircMsg) string {
+	switch m.command {
+	case "PRIVMSG", "NOTICE":
+		if cmd, _, ok := parseCTCP(m.trail()); ok && cmd != "ACTION" {
+			return "ctcps"
+		}
+		if m.command == "NOTICE" {
+			return "notices"
+		}
+		return "msgs"
+	case "JOIN", "PART", "QUIT":
+		return "joins"
+	case "NICK":
+		return "nicks"
+	case "INVITE":
+		return "invites"
+	}
+	return ""
+}
+
+// ignored reports whether m comes from an ignored user. Our own lines and
+// server messages never are. (call with mu held)
+func (s *Session) ignored(m ircMsg) bool {
+	if len(s.ignores) == 0 || !strings.Contains(m.prefix, "!") || strings.EqualFold(m.nick(), s.nick) {
+		return false
+	}
+	kind := ignoreKind(m)
+	if kind == "" {
+		return false
+	}
+	for _, e := range s.ignores {
+		if !e.expired() && e.covers(kind) && wildMatch(e.Mask, m.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) cmdIgnore(arg string) {
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	ac := s.activeChan()
+	s.pruneIgnores()
+	if len(f) == 0 {
+		if len(s.ignores) == 0 {
+			ac.addMsg(s.fmtMsg(fgGrey + "Ignore list is empty" + rst))
+			return
+		}
+		ac.addMsg(s.fmtMsg(fgCyan+bold+"── Ignore list ── "+rst+fgGrey+"%d entries"+rst, len(s.ignores)))
+		for i, e := range s.ignores {
+			types, until := "all", ""
+			if len(e.Types) > 0 {
+				types = strings.Join(e.Types, ",")
+			}
+			if !e.Expires.IsZero() {
+				until = "until " + e.Expires.Format("2006-01-02 15:04")
+			}
+			ac.addMsg(s.fmtMsg(fgGreen+"%3d"+rst+" %-36s %-20s "+fgGrey+"%s"+rst, i+1, e.Mask, types, until))
+		}
+		return
+	}
+
+	e := ignoreEntry{Mask: normalMask(f[0])}
+	for i := 1; i < len(f); i++ {
+		t := strings.ToLower(f[i])
+		if t == "-t" && i+1 < len(f) {
+			d, err := time.ParseDuration(f[i+1])
+			if err != nil || d <= 0 {
+				ac.addMsg(s.fmtMsg(fgRed+"Bad duration %s"+rst+fgGrey+" (e.g. 30m, 2h)"+rst, f[i+1]))
+				return
+			}
+			e.Expires = time.Now().Add(d)
+			i++
+			continue
+		}
+		t = strings.TrimSuffix(t, "s") + "s" // accept "msg" and "msgs"
+		known := false
+		for _, k := range ignoreTypes {
+			known = known || k == t
+		}
+		if !known {
+			ac.addMsg(s.fmtMsg(fgRed+"Unknown type %s"+rst+fgGrey+", expected %s"+rst, f[i], strings.Join(ignoreTypes, ", ")))
+			return
+		}
+		e.Types = append(e.Types, t)
+	}
+	for i := range s.ignores {
+		if strings.EqualFold(s.ignores[i].Mask, e.Mask) {
+			s.ignores = append(s.ignores[:i], s.ignores[i+1:]...)
+			break
+		}
+	}
+	s.ignores = append(s.ignores, e)
+	ac.addMsg(s.fmtMsg(fgGrey+"Ignoring "+rst+"%s", e.Mask))
+	s.saveIgnores()
+}
+
+func (s *Session) cmdUnignore(arg string) {
+	arg = strings.TrimSpace(arg)
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	ac := s.activeChan()
+	if arg == "" {
+		ac.addMsg(s.fmtMsg(fgGrey + "Usage: /unignore <mask|N>" + rst))
+		return
+	}
+	idx := -1
+	if n := simpleAtoi(arg); n > 0 && fmt.Sprint(n) == arg && n <= len(s.ignores) {
+		idx = n - 1
+	} else {
+		mask := normalMask(arg)
+		for i, e := range s.ignores {
+			if strings.EqualFold(e.Mask, mask) {
+				idx = i
+			}
+		}
+	}
+	if idx < 0 {
+		ac.addMsg(s.fmtMsg(fgGrey+"Not ignoring %s"+rst, arg))
+		return
+	}
+	ac.addMsg(s.fmtMsg(fgGrey+"No longer ignoring "+rst+"%s", s.ignores[idx].Mask))
+	s.ignores = append(s.ignores[:idx], s.ignores[idx+1:]...)
+	s.saveIgnores()
+}
+
+// pruneIgnores drops expired entries. (call with mu held)
+func (s *Session) pruneIgnores() {
+	kept := s.ignores[:0]
+	for _, e := range s.ignores {
+		if !e.expired() {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) != len(s.ignores) {
+		s.ignores = kept
+		s.saveIgnores()
+	}
+}
+
+// ignoreFile is where account's list lives, or "" when not persisting.
+func ignoreFile(account string) string {
+	if *dataDir == "" || account == "" {
+		return ""
+	}
+	// hex keeps any account name a safe file name
+	return filepath.Join(*dataDir, "ignore", fmt.Sprintf("%x.json", strings.ToLower(account)))
+}
+
+// saveIgnores writes the list for the logged-in account. (call with mu held)
+func (s *Session) saveIgnores() {
+	path := ignoreFile(s.account)
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.ignores, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		s.addMsgTo(s.serverCh, s.fmtMsg(fgRed+"Couldn't save ignore list: %s"+rst, err))
+	}
+}
+
+// loadIgnores merges the saved list for the account just logged in with
+// whatever was ignored before login. (call with mu held)
+func (s *Session) loadIgnores() {
+	path := ignoreFile(s.account)
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if len(s.ignores) > 0 {
+			s.saveIgnores()
+		}
+		return
+	}
+	var saved []ignoreEntry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		s.addMsgTo(s.serverCh, s.fmtMsg(fgRed+"Couldn't read ignore list: %s"+rst, err))
+		return
+	}
+	for _, e := range saved {
+		dup := false
+		for _, have := range s.ignores {
+			dup = dup || strings.EqualFold(have.Mask, e.Mask)
+		}
+		if !dup && !e.expired() {
+			s.ignores = append(s.ignores, e)
+		}
+	}
+	if len(saved) > 0 {
+		s.addMsgTo(s.serverCh, s.fmtMsg(fgGrey+"Loaded %d ignores for %s"+rst, len(saved), s.account))
+	}
+	s.saveIgnores()
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestIgnoreKind(t *testing.T) {
+	tests := []struct {
+		command string
+		params  []string
+		want    string
+	}{
+		{"PRIVMSG", []string{"#go", "hello"}, "msgs"},
+		{"PRIVMSG", []string{"#go", "\x01ACTION waves\x01"}, "msgs"},
+		{"PRIVMSG", []string{"me", "\x01VERSION\x01"}, "ctcps"},
+		{"PRIVMSG", []string{"me", "\x01PING 123\x01"}, "ctcps"},
+		{"NOTICE", []string{"me", "hi"}, "notices"},
+		{"NOTICE", []string{"me", "\x01VERSION irssi\x01"}, "ctcps"},
+		{"JOIN", []string{"#go"}, "joins"},
+		{"PART", []string{"#go", "bye"}, "joins"},
+		{"QUIT", []string{"bye"}, "joins"},
+		{"NICK", []string{"other"}, "nicks"},
+		{"INVITE", []string{"me", "#go"}, "invites"},
+		{"MODE", []string{"#go", "+o", "me"}, ""},
+	}
+	for _, tt := range tests {
+		m := ircMsg{prefix: "bob!b@host", command: tt.command, params: tt.params}
+		if got := ignoreKind(m); got != tt.want {
+			t.Errorf("ignoreKind(%s %q) = %q, want %q", tt.command, tt.params, got, tt.want)
+		}
+	}
+}
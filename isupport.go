@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// ── ISUPPORT ──
+// 005 RPL_ISUPPORT tokens, e.g. MODES=4, ELIST=CMNTU, KNOCK, CASEMAPPING=rfc1459.
+
+// parseISupport merges one 005 line into s.isupport. (call with mu held)
+func (s *Session) parseISupport(m ircMsg) {
+	if len(m.params) < 3 {
+		return
+	}
+	for _, tok := range m.params[1 : len(m.params)-1] {
+		if strings.HasPrefix(tok, "-") {
+			delete(s.isupport, strings.ToUpper(tok[1:]))
+			continue
+		}
+		key, val, _ := strings.Cut(tok, "=")
+		s.isupport[strings.ToUpper(key)] = val
+	}
+}
+
+// support returns the value of an ISUPPORT token and whether the server
+// advertised it. (call with mu held)
+func (s *Session) support(key string) (string, bool) {
+	v, ok := s.isupport[key]
+	return v, ok
+}
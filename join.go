@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Joining ──
+// Channel keys are remembered from /join and +k so rejoins use them, and
+// join failures are explained in the window the user is looking at.
+
+// joinLine builds the JOIN for ch with its known key and notes the join as
+// pending. (call with mu held)
+func (s *Session) joinLine(ch string) string {
+	s.joining[strings.ToLower(ch)] = true
+	key := s.joinKeys[strings.ToLower(ch)]
+	if c := s.getChan(ch); c != nil && c.key != "" {
+		key = c.key
+	}
+	if key != "" {
+		return "JOIN " + ch + " " + key
+	}
+	return "JOIN " + ch
+}
+
+func (s *Session) cmdJoin(arg string) {
+	f := strings.Fields(arg)
+	if len(f) == 0 {
+		return
+	}
+	ch := f[0]
+	if !strings.HasPrefix(ch, "#") {
+		ch = "#" + ch
+	}
+	s.mu.Lock()
+	if len(f) > 1 {
+		s.joinKeys[strings.ToLower(ch)] = f[1]
+	}
+	if c := s.getChan(ch); c != nil {
+		c.rejoinGen++ // joining by hand ends a pending auto-rejoin
+	}
+	line := s.joinLine(ch)
+	s.mu.Unlock()
+	s.ircSend(line)
+}
+
+// joined moves a key given to /join onto the channel and ends any pending
+// auto-rejoin. (call with mu held)
+func (s *Session) joined(c *Channel) {
+	c.rejoinGen++
+	low := strings.ToLower(c.name)
+	delete(s.joining, low)
+	if key, ok := s.joinKeys[low]; ok {
+		c.key = key
+		delete(s.joinKeys, low)
+	}
+}
+
+// chanKey picks the +k argument out of a 324 mode string using CHANMODES
+// to know which letters take parameters; ok is false when +k isn't set.
+// Servers show "*" to non-members. (call with mu held)
+func (s *Session) chanKey(modes []string) (key string, ok bool) {
+	if len(modes) == 0 {
+		return "", false
+	}
+	cm, have := s.support("CHANMODES")
+	if !have {
+		cm = "beI,k,l,imnpst"
+	}
+	kinds := strings.Split(cm, ",")
+	withArg := ""
+	for i := 0; i < len(kinds) && i < 3; i++ {
+		withArg += kinds[i]
+	}
+	args := modes[1:]
+	for _, l := range strings.TrimPrefix(modes[0], "+") {
+		if !strings.ContainsRune(withArg, l) {
+			continue
+		}
+		if len(args) == 0 {
+			break
+		}
+		if l == 'k' {
+			return args[0], true
+		}
+		args = args[1:]
+	}
+	return "", strings.ContainsRune(modes[0], 'k')
+}
+
+// joinFailed explains a join error numeric in the active window. 403, 405
+// and 489 also answer other commands, so they only count for a pending join.
+// (call without mu held)
+func (s *Session) joinFailed(m ircMsg) {
+	if len(m.params) < 2 {
+		return
+	}
+	ch := m.params[1]
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	low := strings.ToLower(ch)
+	if !s.joining[low] && (m.command == "403" || m.command == "405" || m.command == "489") {
+		s.showNumeric(m)
+		return
+	}
+	delete(s.joining, low)
+	hint := ""
+	switch m.command {
+	case "471": // ERR_CHANNELISFULL
+		hint = "the channel is full (+l)"
+	case "473": // ERR_INVITEONLYCHAN
+		hint = "the channel is invite only (+i)"
+		if _, ok := s.support("KNOCK"); ok {
+			hint += ", ask for an invite with " + fgGreen + "/knock " + ch + rst
+		}
+	case "474": // ERR_BANNEDFROMCHAN
+		hint = "you are banned (+b)"
+		s.rejoinBanned(ch)
+	case "475": // ERR_BADCHANNELKEY
+		hint = "it needs a key (+k), try " + fgGreen + "/join " + ch + " <key>" + rst
+		delete(s.joinKeys, strings.ToLower(ch))
+		if c := s.getChan(ch); c != nil {
+			c.key = ""
+		}
+	case "477": // ERR_NEEDREGGEDNICK
+		hint = "you need a registered, identified nick"
+	case "489": // ERR_SECUREONLYCHAN
+		hint = "it only allows TLS connections (+z)"
+	case "403": // ERR_NOSUCHCHANNEL
+		hint = "no such channel"
+	case "405": // ERR_TOOMANYCHANNELS
+		hint = "you have joined too many channels"
+	}
+	s.activeChan().addMsg(s.fmtMsg(fgRed+bold+"✗ "+rst+fgRed+"Can't join %s"+rst+": %s "+fgGrey+"(%s)"+rst, ch, hint, m.trail()))
+}
+
+func (s *Session) cmdKnock(arg string) {
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	_, ok := s.support("KNOCK")
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		s.opNote("This server doesn't support KNOCK")
+	case len(f) == 0:
+		s.opNote("Usage: /knock #channel [message]")
+	case len(f) == 1:
+		s.ircSend("KNOCK " + f[0])
+	default:
+		s.ircSend(fmt.Sprintf("KNOCK %s :%s", f[0], strings.Join(f[1:], " ")))
+	}
+}
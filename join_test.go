@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestJoinFailedClearsPending(t *testing.T) {
+	for _, code := range []string{"471", "473", "474", "475", "477", "489", "403", "405"} {
+		s := newSession(&countConn{})
+		s.joining["#chan"] = true
+		s.joinFailed(ircMsg{command: code, params: []string{"me", "#Chan", "Cannot join channel"}})
+		if s.joining["#chan"] {
+			t.Errorf("%s left the join pending", code)
+		}
+	}
+}
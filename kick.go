@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ── Kick auto-rejoin ──
+// After a kick we rejoin after /set rejoin seconds with a countdown in the
+// channel, give up after /set rejoinmax kicks in a row, and stop for good
+// when the server answers 474 (banned).
+
+const rejoinReset = 5 * time.Minute // kicks further apart than this start a new run
+
+func rejoinGet(s *Session) string {
+	if s.rejoinDelay < 0 {
+		return "off"
+	}
+	return strconv.Itoa(s.rejoinDelay)
+}
+
+func rejoinSet(s *Session, v string) error {
+	if v == "off" {
+		s.rejoinDelay = -1
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 600 {
+		return errors.New("expected off or a delay in seconds (0-600)")
+	}
+	s.rejoinDelay = n
+	return nil
+}
+
+// kicked handles us being kicked from c. (call with mu held)
+func (s *Session) kicked(c *Channel, by, reason string) {
+	c.nicks = make(map[string]string)
+	c.rejoinGen++
+	s.addMsgTo(c, s.fmtMsg(fgRed+bold+"Kicked by %s"+rst+fgRed+" (%s)"+rst, by, reason))
+	if s.rejoinDelay < 0 {
+		s.addMsgTo(c, s.fmtMsg(fgGrey+"Auto-rejoin is off, /join %s to return"+rst, c.name))
+		return
+	}
+	if time.Since(c.lastKick) > rejoinReset {
+		c.rejoinTries = 0
+	}
+	c.lastKick = time.Now()
+	c.rejoinTries++
+	if s.rejoinMax > 0 && c.rejoinTries > s.rejoinMax {
+		s.addMsgTo(c, s.fmtMsg(fgGrey+"Kicked %d times in a row, not rejoining. /join %s to return"+rst, c.rejoinTries, c.name))
+		return
+	}
+	go s.rejoinAfter(c, c.rejoinGen, s.rejoinDelay)
+}
+
+// rejoinAfter counts down in c's window and rejoins, unless the channel was
+// closed or the rejoin cancelled meanwhile. (call without mu held)
+func (s *Session) rejoinAfter(c *Channel, gen, secs int) {
+	line := ""
+	for left := secs; ; left-- {
+		s.mu.Lock()
+		if !s.alive || s.getChan(c.name) != c || c.rejoinGen != gen {
+			s.mu.Unlock()
+			return
+		}
+		if left <= 0 {
+			if line != "" {
+				c.replaceMsg(line, s.fmtMsg(fgGrey+"Rejoining %s…"+rst, c.name))
+			}
+			join := s.joinLine(c.name)
+			s.mu.Unlock()
+			s.ircSend(join)
+			s.draw()
+			return
+		}
+		next := s.fmtMsg(fgGrey+"Rejoining in %ds… "+rst+fgGrey+"(/join to go now, /part to stay out)"+rst, left)
+		if line == "" || !c.replaceMsg(line, next) {
+			s.addMsgTo(c, next)
+		}
+		line = next
+		s.mu.Unlock()
+		s.draw()
+		time.Sleep(time.Second)
+	}
+}
+
+// replaceMsg swaps a recent line for another; reports whether it was found.
+func (c *Channel) replaceMsg(old, repl string) bool {
+	for i := len(c.msgs) - 1; i >= 0 && i >= len(c.msgs)-50; i-- {
+		if c.msgs[i] == old {
+			c.msgs[i] = repl
+			return true
+		}
+	}
+	return false
+}
+
+// rejoinBanned stops auto-rejoin for ch after a 474. (call with mu held)
+func (s *Session) rejoinBanned(ch string) {
+	c := s.getChan(ch)
+	if c == nil || c.rejoinTries == 0 {
+		return
+	}
+	c.rejoinGen++
+	c.rejoinTries = 0
+	s.addMsgTo(c, s.fmtMsg(fgGrey+"Banned from %s, auto-rejoin stopped"+rst, c.name))
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ── Channel list browser ──
+// /list opens a *list window fed by 322/323. In that window typed text
+// filters, ↑/↓ + Enter moves the selection and an empty Enter joins it.
+
+const listWin = "*list"
+
+type listEntry struct {
+	name  string
+	users int
+	topic string
+}
+
+type chanList struct {
+	entries []listEntry
+	view    []int // indexes into entries, filtered and sorted
+	filter  string
+	sortBy  string // users, name, topic
+	sel     int    // index into view
+	top     int    // first view row on screen
+	done    bool   // 323 received
+}
+
+// rebuild re-applies filter and sort order. (call with mu held)
+func (l *chanList) rebuild() {
+	f := strings.ToLower(l.filter)
+	l.view = l.view[:0]
+	for i, e := range l.entries {
+		if f == "" || strings.Contains(strings.ToLower(e.name), f) || strings.Contains(strings.ToLower(e.topic), f) {
+			l.view = append(l.view, i)
+		}
+	}
+	sort.SliceStable(l.view, func(a, b int) bool {
+		x, y := l.entries[l.view[a]], l.entries[l.view[b]]
+		switch l.sortBy {
+		case "name":
+			return strings.ToLower(x.name) < strings.ToLower(y.name)
+		case "topic":
+			return strings.ToLower(x.topic) < strings.ToLower(y.topic)
+		}
+		return x.users > y.users
+	})
+	l.move(0)
+}
+
+// move shifts the selection by delta, clamped to the view.
+func (l *chanList) move(delta int) {
+	l.sel += delta
+	if l.sel >= len(l.view) {
+		l.sel = len(l.view) - 1
+	}
+	if l.sel < 0 {
+		l.sel = 0
+	}
+}
+
+// lines renders the browser into rows lines of chat text. (call with mu held)
+func (l *chanList) lines(rows int) []string {
+	status := fmt.Sprintf("%d/%d channels", len(l.view), len(l.entries))
+	if !l.done {
+		status = fmt.Sprintf("receiving… %d", len(l.entries))
+	}
+	filter := l.filter
+	if filter == "" {
+		filter = "none"
+	}
+	out := []string{
+		fgCyan + bold + " Channel list " + rst + fgGrey + "│ " + status + " │ sort: " + rst + l.sortBy +
+			fgGrey + " │ filter: " + rst + filter +
+			fgGrey + " │ type to filter, ↑/↓+Enter move, Enter joins, /sort users|name|topic" + rst,
+	}
+	avail := rows - 1
+	if avail < 1 {
+		return out
+	}
+	if l.sel < l.top {
+		l.top = l.sel
+	}
+	if l.sel >= l.top+avail {
+		l.top = l.sel - avail + 1
+	}
+	for i := l.top; i < len(l.view) && i < l.top+avail; i++ {
+		e := l.entries[l.view[i]]
+		line := fmt.Sprintf(" %-24s %6d  %s", e.name, e.users, e.topic)
+		if i == l.sel {
+			line = "\033[7m" + line + rst
+		} else {
+			line = fgCyan + fmt.Sprintf(" %-24s", e.name) + rst + fgGrey + fmt.Sprintf(" %6d  ", e.users) + rst + e.topic
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// cmdList implements /list [filter]. ELIST conditions (>N, <N, masks) go to
+// the server when it supports them; anything else filters locally.
+func (s *Session) cmdList(arg string) {
+	arg = strings.TrimSpace(arg)
+	s.mu.Lock()
+	elist, _ := s.support("ELIST")
+	elist = strings.ToUpper(elist)
+	query := "LIST"
+	filter := arg
+	switch {
+	case arg == "":
+	case (arg[0] == '>' || arg[0] == '<') && strings.ContainsRune(elist, 'U'):
+		query, filter = "LIST "+arg, ""
+	case strings.ContainsAny(arg, "*?") && strings.ContainsRune(elist, 'M'):
+		query, filter = "LIST "+arg, ""
+	}
+	c := s.getOrMakeChan(listWin)
+	c.list = &chanList{filter: filter, sortBy: "users"}
+	s.switchTo(listWin)
+	s.mu.Unlock()
+	s.ircSend(query)
+	s.draw()
+}
+
+// listReply records one 322 RPL_LIST line. (call without mu held)
+func (s *Session) listReply(m ircMsg) {
+	// me channel users :topic
+	if len(m.params) < 3 {
+		return
+	}
+	s.mu.Lock()
+	if c := s.getChan(listWin); c != nil && c.list != nil && !c.list.done {
+		c.list.entries = append(c.list.entries, listEntry{m.params[1], simpleAtoi(m.params[2]), stripModes(m.trail())})
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// listEnd handles 323 RPL_LISTEND. (call without mu held)
+func (s *Session) listEnd() {
+	s.mu.Lock()
+	if c := s.getChan(listWin); c != nil && c.list != nil {
+		c.list.done = true
+		c.list.rebuild()
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// activeList returns the browser if the list window is in front.
+// (call with mu held)
+func (s *Session) activeList() *chanList {
+	return s.activeChan().list
+}
+
+// listKeys moves the selection; reports whether the list window took the
+// keys. (call without mu held)
+func (s *Session) listKeys(ups, downs int) bool {
+	s.mu.Lock()
+	l := s.activeList()
+	if l != nil {
+		l.move(downs - ups)
+	}
+	s.mu.Unlock()
+	if l != nil {
+		s.draw()
+	}
+	return l != nil
+}
+
+// listEnter joins the selected channel on an empty Enter; reports whether
+// the list window took it. (call without mu held)
+func (s *Session) listEnter() bool {
+	s.mu.Lock()
+	l := s.activeList()
+	join := ""
+	if l != nil && l.sel < len(l.view) {
+		join = s.joinLine(l.entries[l.view[l.sel]].name)
+	}
+	s.mu.Unlock()
+	if join != "" {
+		s.ircSend(join)
+	}
+	return l != nil
+}
+
+// listInput sets the filter or sort order. (call without mu held)
+func (s *Session) listInput(text string) {
+	s.mu.Lock()
+	if l := s.activeList(); l != nil {
+		if by, ok := strings.CutPrefix(text, "/sort"); ok {
+			by = strings.TrimSpace(strings.ToLower(by))
+			if by == "users" || by == "name" || by == "topic" {
+				l.sortBy = by
+			}
+		} else {
+			l.filter = text
+			if text == "-" || text == "*" {
+				l.filter = ""
+			}
+			l.sel, l.top = 0, 0
+		}
+		if l.done {
+			l.rebuild()
+		}
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// stripModes drops the "[+nt]" mode prefix some servers put in 322 topics.
+func stripModes(topic string) string {
+	if strings.HasPrefix(topic, "[+") {
+		if i := strings.Index(topic, "] "); i >= 0 {
+			return topic[i+2:]
+		}
+	}
+	return topic
+}
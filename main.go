@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -38,6 +40,7 @@ func randNick() string {
 const (
 	rst     = "\033[0m"
 	bold    = "\033[1m"
+	dim     = "\033[2m"
 	clrLine = "\033[2K"
 	clrEOL  = "\033[K"
 	hideCur = "\033[?25l"
@@ -61,45 +64,6 @@ const (
 
 func pos(r, c int) string { return fmt.Sprintf("\033[%d;%dH", r, c) }
 
-var nickColors = []string{fgRed, fgGreen, fgYellow, fgBlue, fgMagenta, fgCyan}
-
-func nickColor(nick string) string {
-	h := 0
-	for _, c := range nick {
-		h = h*31 + int(c)
-	}
-	if h < 0 {
-		h = -h
-	}
-	return nickColors[h%len(nickColors)]
-}
-
-func truncVis(s string, maxW int) string {
-	var b strings.Builder
-	vis := 0
-	inEsc := false
-	for _, r := range s {
-		if r == '\033' {
-			inEsc = true
-			b.WriteRune(r)
-			continue
-		}
-		if inEsc {
-			b.WriteRune(r)
-			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
-				inEsc = false
-			}
-			continue
-		}
-		if vis >= maxW {
-			break
-		}
-		b.WriteRune(r)
-		vis++
-	}
-	return b.String()
-}
-
 func simpleAtoi(s string) int {
 	n := 0
 	for _, c := range s {
@@ -146,39 +110,28 @@ func sortedNicks(nicks map[string]string) []string {
 	return list
 }
 
-func nickDisplayColor(n string) string {
-	for _, ch := range n {
-		switch ch {
-		case '~':
-			return fgRed + bold
-		case '&':
-			return fgRed
-		case '@':
-			return fgGreen
-		case '%':
-			return fgCyan
-		case '+':
-			return fgYellow
-		default:
-			return fgWhite
-		}
-	}
-	return fgWhite
+// Numerics with their own handler; anything else is also dumped to *status
+var quietNumerics = map[string]bool{
+	"353": true, "366": true,
+	// WHOIS / WHOWAS / WHO
+	"311": true, "312": true, "313": true, "314": true, "317": true, "318": true, "319": true,
+	"330": true, "338": true, "369": true, "671": true, "276": true, "307": true, "320": true,
+	"378": true, "379": true, "352": true, "315": true,
+	// LIST
+	"321": true, "322": true, "323": true,
+	"482": true,
+	// Ban / exception / invite lists
+	"367": true, "368": true, "348": true, "349": true, "346": true, "347": true,
+	// Topic
+	"331": true, "332": true, "333": true, "329": true,
+	// Join failures
+	"471": true, "473": true, "474": true, "475": true, "477": true, "489": true, "403": true, "405": true,
+	// Nick errors
+	"432": true, "433": true, "436": true, "437": true,
+	// Away
+	"301": true, "305": true, "306": true,
 }
 
-// ── Telnet IAC ──
-
-const (
-	iacByte = 0xFF
-	iacSB   = 0xFA
-	iacSE   = 0xF0
-	iacWILL = 0xFB
-	iacWONT = 0xFC
-	iacDO   = 0xFD
-	iacDONT = 0xFE
-	optNAWS = 0x1F
-)
-
 // ── IRC parser ──
 
 type ircMsg struct {
@@ -235,6 +188,36 @@ func parseIRC(line string) ircMsg {
 	return m
 }
 
+// stripControls removes ESC and the other C0/C1 controls, mIRC color codes
+// included, from the prefix and params, so remote text can't carry
+// terminal escapes or the theme's role codes into a buffer. \x01 stays
+// for CTCP.
+func (m *ircMsg) stripControls() {
+	ctl := func(r rune) bool { return r < 0x20 && r != 0x01 || r >= 0x7f && r < 0xa0 }
+	clean := func(str string) string {
+		if strings.IndexFunc(str, ctl) < 0 {
+			return str
+		}
+		var b strings.Builder
+		for i := 0; i < len(str); {
+			r, size := utf8.DecodeRuneInString(str[i:])
+			i += size
+			switch {
+			case r == 0x03:
+				i += mircColorLen(str[i:])
+			case ctl(r):
+			default:
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+	m.prefix = clean(m.prefix)
+	for i, p := range m.params {
+		m.params[i] = clean(p)
+	}
+}
+
 // ── Channel buffer ──
 
 type Channel struct {
@@ -244,8 +227,28 @@ type Channel struct {
 	msgs       []string
 	nicks      map[string]string
 	nickScroll int
-	unread     bool
-	highlight  bool
+	scroll     int       // chat lines scrolled up from the bottom
+	base       int       // lines trimmed off the front, keeps line numbers stable
+	unread     int       // chat lines added while in the background
+	highlight  int       // of those, mentions or PMs
+	list       *chanList // set on the *list browser window
+
+	lastSpoke map[string]time.Time // by lowercase nick, for the smart filter
+	spokeGC   time.Time            // last prune of lastSpoke
+	hidden    int                  // lines in msgs marked roleHidden
+	run       *eventRun            // collapsed join/part line being extended
+	smart     *bool                // /filter overrides, nil = use /set
+	collapse  *bool
+	key       string // +k, used when rejoining
+
+	rejoinGen   int // bumped to cancel a pending auto-rejoin
+	rejoinTries int // kicks in the current run
+	lastKick    time.Time
+
+	topicBy string    // who set the topic
+	topicAt time.Time // when
+	created time.Time // 329 RPL_CREATIONTIME
+	topics  []topicChange
 }
 
 func newChannel(name string) *Channel {
@@ -254,8 +257,22 @@ func newChannel(name string) *Channel {
 
 func (c *Channel) addMsg(line string) {
 	c.msgs = append(c.msgs, line)
+	c.run = nil
+	if strings.HasPrefix(line, roleHidden) {
+		c.hidden++
+	} else if c.scroll > 0 {
+		c.scroll++ // keep a scrolled view on the same lines
+	}
 	if len(c.msgs) > maxMsgs {
-		c.msgs = c.msgs[len(c.msgs)-maxMsgs:]
+		drop := len(c.msgs) - maxMsgs
+		for _, m := range c.msgs[:drop] {
+			if strings.HasPrefix(m, roleHidden) {
+				c.hidden--
+			}
+		}
+		c.base += drop
+		c.scroll = min(c.scroll, maxMsgs)
+		c.msgs = c.msgs[drop:]
 	}
 }
 
@@ -264,6 +281,7 @@ func (c *Channel) addMsg(line string) {
 type clientReader struct {
 	conn net.Conn
 	sess *Session
+	tel  telnet
 	buf  []byte
 	tmp  [2048]byte
 }
@@ -288,53 +306,46 @@ func (r *clientReader) ReadLine() (string, error) {
 }
 
 func (r *clientReader) ingest(data []byte) {
-	i := 0
-	for i < len(data) {
-		b := data[i]
-		if b == iacByte && i+1 < len(data) {
-			consumed := r.handleIAC(data, i)
-			if consumed > 0 {
-				i += consumed
-				continue
-			}
-		}
-		r.buf = append(r.buf, b)
-		i++
+	r.buf = r.tel.feed(data, r.buf)
+	r.flushTelnet()
+}
+
+func (r *clientReader) flushTelnet() {
+	if len(r.tel.reply) > 0 {
+		r.sess.raw(string(r.tel.reply))
+		r.tel.reply = r.tel.reply[:0]
 	}
 }
 
-func (r *clientReader) handleIAC(data []byte, i int) int {
-	if i+1 >= len(data) {
-		return 1
+// negotiate asks the client for window size, terminal type and locale.
+func (r *clientReader) negotiate() {
+	for _, opt := range []byte{optNAWS, optTTYPE, optNEWENV} {
+		r.tel.himOK[opt] = true
+		r.tel.enableHim(opt)
 	}
-	cmd := data[i+1]
-	switch cmd {
-	case iacByte:
-		r.buf = append(r.buf, 0xFF)
-		return 2
-	case iacWILL, iacWONT, iacDO, iacDONT:
-		if i+2 >= len(data) {
-			return 2
+	r.tel.enabled = func(opt byte) {
+		switch opt {
+		case optTTYPE:
+			r.tel.reply = append(r.tel.reply, ttypeSend()...)
+		case optNEWENV:
+			r.tel.reply = append(r.tel.reply, environSend()...)
 		}
-		return 3
-	case iacSB:
-		for j := i + 2; j < len(data)-1; j++ {
-			if data[j] == iacByte && data[j+1] == iacSE {
-				sub := data[i+2 : j]
-				if len(sub) >= 5 && sub[0] == optNAWS {
-					w := int(sub[1])<<8 | int(sub[2])
-					h := int(sub[3])<<8 | int(sub[4])
-					if w > 10 && h > 5 {
-						r.sess.resize(w, h)
-					}
-				}
-				return j + 2 - i
+	}
+	r.tel.sub = func(opt byte, sub []byte) {
+		switch {
+		case opt == optNAWS && len(sub) >= 4:
+			w := int(sub[0])<<8 | int(sub[1])
+			h := int(sub[2])<<8 | int(sub[3])
+			if w > 10 && h > 5 {
+				r.sess.resize(w, h)
 			}
+		case opt == optTTYPE && len(sub) >= 1 && sub[0] == tIS:
+			r.sess.setTermType(string(sub[1:]))
+		case opt == optNEWENV && len(sub) >= 1 && (sub[0] == tIS || sub[0] == tINFO):
+			r.sess.setEnv(parseEnviron(sub[1:]))
 		}
-		return len(data) - i
-	default:
-		return 2
 	}
+	r.flushTelnet()
 }
 
 func (r *clientReader) extractCPR() {
@@ -381,24 +392,115 @@ type Session struct {
 	serverCh   *Channel
 	history    []string
 	historyPos int
+
+	scr   *frame        // last frame sent to the client (guarded by writeMu)
+	dirty chan struct{} // pending redraw for renderLoop
+	theme *Theme
+
+	term     string            // TERMINAL-TYPE, lowercased
+	env      map[string]string // NEW-ENVIRON variables
+	gotEnv   bool              // the client answered NEW-ENVIRON
+	charset  charset
+	themeSet bool // user picked a theme, don't auto-adapt
+
+	sendq    *sendQueue
+	userhost string // our user@host as others see it, "" until known
+
+	paste   []string // held paste awaiting y/N
+	pasteTo string
+
+	ctcpTimes []time.Time // recent CTCP replies, for rate limiting
+
+	whois map[string]*whoisResult // pending WHOIS/WHOWAS by lowercase nick
+	whoQ  []*whoReq               // pending WHOs, answered in order
+
+	isupport map[string]string // 005 tokens
+
+	users   map[string]*ircUser // seen nick → user@host, by lowercase nick
+	banMask string              // /set banmask
+
+	rawLog    bool                 // *raw window open
+	maskLists map[string]*maskList // ban/exception/invite lists by kind + channel
+	joinKeys  map[string]string    // keys given to /join, until the JOIN lands
+	joining   map[string]bool      // lowercase channels with a JOIN in flight
+
+	rejoinDelay int // seconds, -1 = off
+	rejoinMax   int // 0 = unlimited
+
+	registered bool     // 001 received
+	wantNick   string   // nick registration started with
+	nickTry    int      // collisions so far during registration
+	altNicks   []string // /set altnicks
+	account    string   // services account, from 900
+
+	caps  map[string]bool // acknowledged IRCv3 capabilities
+	capLS []string        // CAP LS lines collected so far
+
+	away         bool // 306 received
+	autoAway     bool // the away was set by autoAwayLoop
+	autoAwayMins int  // /set autoaway
+	lastInput    time.Time
+
+	ignores []ignoreEntry
+
+	hlWords   []hlPattern // /set hlwords
+	hlExclude []hlPattern // /set hlexclude
+	hls       []hlRef     // entries of *highlights
+	hlBase    int         // highlights trimmed off the front
+	notify    string      // /set notify
+	alerts    string      // notification sequences sent with the next frame
+
+	smart     bool // /set smartfilter
+	smartMins int  // /set smartdelay
+	collapse  bool // /set collapse
+
+	splits   []*netsplit // recent netsplits, oldest first
+	splitSeq int
 }
 
 func newSession(conn net.Conn) *Session {
 	srv := newChannel("*status")
 	return &Session{
-		conn:     conn,
-		nick:     randNick(),
-		w:        defW,
-		h:        defH,
-		alive:    true,
-		channels: []*Channel{srv},
-		active:   0,
-		showNick: true,
-		showChan: true,
-		serverCh: srv,
+		conn:      conn,
+		nick:      randNick(),
+		w:         defW,
+		h:         defH,
+		alive:     true,
+		channels:  []*Channel{srv},
+		active:    0,
+		showNick:  true,
+		showChan:  true,
+		serverCh:  srv,
+		dirty:     make(chan struct{}, 1),
+		theme:     themes["default"],
+		env:       make(map[string]string),
+		sendq:     newSendQueue(),
+		whois:     make(map[string]*whoisResult),
+		isupport:  make(map[string]string),
+		users:     make(map[string]*ircUser),
+		maskLists: make(map[string]*maskList),
+		joinKeys:  make(map[string]string),
+		joining:   make(map[string]bool),
+		caps:      make(map[string]bool),
+		lastInput: time.Now(),
+		notify:    "off",
+		smartMins: 5,
+
+		rejoinDelay: 5,
+		rejoinMax:   3,
+		banMask:     "host",
 	}
 }
 
+// showNumeric prints a server reply in *status as is. (call with mu held)
+func (s *Session) showNumeric(m ircMsg) {
+	display := m.trail()
+	if display == "" {
+		display = strings.Join(m.params, " ")
+	}
+	s.addMsgTo(s.serverCh, s.fmtMsg(fgGrey+"["+m.command+"]"+rst+" %s", display))
+}
+
 func (s *Session) raw(data string) {
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
@@ -408,8 +510,7 @@ func (s *Session) raw(data string) {
 
 func (s *Session) ircSend(line string) {
 	if s.irc != nil {
-		s.irc.SetWriteDeadline(time.Now().Add(5 * time.Second))
-		s.irc.Write([]byte(line + "\r\n"))
+		s.sendq.push(line)
 	}
 }
 
@@ -444,8 +545,8 @@ func (s *Session) switchTo(name string) bool {
 	for i, c := range s.channels {
 		if strings.ToLower(c.name) == low {
 			s.active = i
-			c.unread = false
-			c.highlight = false
+			c.unread = 0
+			c.highlight = 0
 			return true
 		}
 	}
@@ -455,8 +556,8 @@ func (s *Session) switchTo(name string) bool {
 func (s *Session) switchToIdx(idx int) bool {
 	if idx >= 0 && idx < len(s.channels) {
 		s.active = idx
-		s.channels[idx].unread = false
-		s.channels[idx].highlight = false
+		s.channels[idx].unread = 0
+		s.channels[idx].highlight = 0
 		return true
 	}
 	return false
@@ -480,14 +581,21 @@ func (s *Session) removeChan(name string) {
 }
 
 func (s *Session) fmtMsg(format string, args ...interface{}) string {
-	ts := fgGrey + time.Now().Format("15:04") + rst
+	ts := roleTS + time.Now().Format("15:04") + rst
 	return ts + " " + fmt.Sprintf(format, args...)
 }
 
+// addMsgTo adds an informational line to ch; it doesn't count as unread.
 func (s *Session) addMsgTo(ch *Channel, line string) {
 	ch.addMsg(line)
+}
+
+// addChatTo adds a PRIVMSG, NOTICE or ACTION line to ch, counting it as
+// unread unless ch is active. (call with mu held)
+func (s *Session) addChatTo(ch *Channel, line string) {
+	ch.addMsg(line)
 	if ch != s.activeChan() {
-		ch.unread = true
+		ch.unread++
 	}
 }
 
@@ -585,7 +693,7 @@ func (s *Session) resize(w, h int) {
 	s.w = w
 	s.h = h
 	s.mu.Unlock()
-	s.raw("\033[r" + clrScr) // Reset scroll region then clear
+	s.invalidate() // Next frame resets the scroll region and clears
 	s.draw()
 }
 
@@ -594,8 +702,10 @@ func (s *Session) resize(w, h int) {
 // Row 2..H-2:   [chanlist │ chat │ nicklist]  (mainH rows)
 // Row H-1:      Status bar
 // Row H:        nick » input (single line)
+//
+// Handlers call draw() to mark the screen dirty; renderLoop does the work.
 
-func (s *Session) draw() {
+func (s *Session) render() {
 	s.mu.Lock()
 
 	w := s.w
@@ -609,6 +719,14 @@ func (s *Session) draw() {
 		nlW = 0
 	}
 	nick := s.nick
+	th := s.theme
+	cs := s.charset
+	termTag := s.termTag()
+	queued := s.sendq.pending()
+	pastePrompt := ""
+	if s.paste != nil {
+		pastePrompt = s.pastePrompt()
+	}
 
 	// Copy state under lock
 	chanName := ac.name
@@ -616,29 +734,41 @@ func (s *Session) draw() {
 	chanTopic := ac.topic
 	nickCount := len(ac.nicks)
 	nickScroll := ac.nickScroll
+	scroll := 0
 	activeIdx := s.active
 
-	msgs := make([]string, len(ac.msgs))
-	copy(msgs, ac.msgs)
+	var msgs []string
+	if ac.list != nil {
+		msgs = ac.list.lines(mH)
+	} else {
+		scroll = min(ac.scroll, max(s.visibleCount(ac)-mH, 0))
+		msgs = s.visibleTail(ac, mH+scroll)
+	}
 
 	type ci struct {
 		name      string
 		unread    bool
 		highlight bool
 	}
+	hot := s.hotlist(th)
 	chans := make([]ci, len(s.channels))
 	for i, c := range s.channels {
 		n := c.name
 		if i == 0 {
 			n = "status"
 		}
-		chans[i] = ci{n, c.unread, c.highlight}
+		chans[i] = ci{n, c.unread > 0, c.highlight > 0}
 	}
 
 	var allNicks []string
+	var awayNicks map[string]bool
 	if nlW > 0 {
 		allNicks = sortedNicks(ac.nicks)
+		awayNicks = s.awayNicks(ac)
 	}
+	away := s.away
+	alerts := s.alerts
+	s.alerts = ""
 
 	s.mu.Unlock()
 
@@ -662,7 +792,7 @@ func (s *Session) draw() {
 	// Message window
 	msgStart := 0
 	if len(msgs) > mH {
-		msgStart = len(msgs) - mH
+		msgStart = len(msgs) - mH - scroll
 	}
 
 	// Nick scroll logic
@@ -678,12 +808,9 @@ func (s *Session) draw() {
 		avail--
 	}
 
-	// Build frame
-	var f strings.Builder
-	f.Grow(16384)
-	f.WriteString("\033[r")    // Reset scroll region for full-screen drawing
-	f.WriteString("\033[?7l") // Disable autowrap (prevents input wrapping to next line)
-	f.WriteString(hideCur)
+	fr := newFrame(w, h)
+	fr.th = th
+	fr.cs = cs
 
 	// ── Row 1: Top bar ──
 	topText := " " + chanName
@@ -693,64 +820,50 @@ func (s *Session) draw() {
 	if chanTopic != "" {
 		topText += " │ " + chanTopic
 	}
-	runes := []rune(topText)
-	if len(runes) > w {
-		runes = runes[:w]
-	}
-	f.WriteString(pos(1, 1) + bgBlue + fgWhite + bold)
-	f.WriteString(string(runes))
-	if pad := w - len(runes); pad > 0 {
-		f.WriteString(strings.Repeat(" ", pad))
-	}
-	f.WriteString(rst)
+	fr.fill(1, 1, w, th.topbar)
+	fr.put(1, 1, th.topbar, topText, w)
 
 	// ── Main area: rows 2 .. mH+1 ──
 	for i := 0; i < mH; i++ {
 		row := i + 2
-		f.WriteString(pos(row, 1) + clrLine)
 
 		// Channel list
 		if clW > 0 {
 			if i < len(chans) {
 				label := chans[i].name
 				tag := fmt.Sprintf("%d %s", i, label)
-				if len(tag) > clW-1 {
-					tag = tag[:clW-1]
-				}
+				style := th.chanIdle
 				if i == activeIdx {
-					f.WriteString(bold + fgWhite + " " + tag + rst)
-			} else if chans[i].highlight {
-				f.WriteString(fgYellow + bold + " " + tag + rst)
+					style = th.chanActive
+				} else if chans[i].highlight {
+					style = th.highlight
 				} else if chans[i].unread {
-					f.WriteString(fgCyan + " " + tag + rst)
-				} else {
-					f.WriteString(fgGrey + " " + tag + rst)
+					style = th.chanUnread
 				}
+				fr.put(row, 1, style, " "+tag, clW)
 			}
-			f.WriteString(pos(row, clW+1) + fgGrey + "│" + rst)
+			fr.put(row, clW+1, th.sep, "│", 1)
 		}
 
 		// Chat message
-		f.WriteString(pos(row, chatCol))
 		if msgStart+i < len(msgs) {
-			f.WriteString(truncVis(msgs[msgStart+i], cw))
+			fr.put(row, chatCol, "", msgs[msgStart+i], cw)
 		}
 
 		// Nick list
 		if nlW > 0 {
 			nickSep := chatCol + cw
-			f.WriteString(pos(row, nickSep) + fgGrey + "│" + rst)
-			f.WriteString(pos(row, nickSep+1))
+			fr.put(row, nickSep, th.sep, "│", 1)
 
 			if i == 0 {
 				// Header
-				f.WriteString(fgCyan + bold + fmt.Sprintf(" %d nicks", nickCount) + rst)
+				fr.put(row, nickSep+1, th.header, fmt.Sprintf(" %d nicks", nickCount), nlW)
 			} else {
 				di := i - 1 // data row index
 				if di == 0 && showUp {
-					f.WriteString(fgGrey + " ▲ /nup" + rst)
+					fr.put(row, nickSep+1, th.sep, " ▲ /nup", nlW)
 				} else if di == dataRows-1 && showDown {
-					f.WriteString(fgGrey + " ▼ /nd" + rst)
+					fr.put(row, nickSep+1, th.sep, " ▼ /nd", nlW)
 				} else {
 					adj := di
 					if showUp {
@@ -759,16 +872,14 @@ func (s *Session) draw() {
 					ni := nickScroll + adj
 					if ni >= 0 && ni < len(allNicks) {
 						n := allNicks[ni]
-						display := n
-						if len(display) > nlW-1 {
-							display = display[:nlW-1]
+						style := th.prefixColor(n)
+						if awayNicks[n] {
+							style = th.away
 						}
-						col := nickDisplayColor(n)
-						f.WriteString(col + " " + display + rst)
+						fr.put(row, nickSep+1, style, " "+n, nlW)
 					}
 				}
 			}
-			f.WriteString(clrEOL)
 		}
 	}
 
@@ -778,14 +889,26 @@ func (s *Session) draw() {
 	if chanMode != "" {
 		modeTag = chanMode
 	}
-	statText := fmt.Sprintf(" %s │ %s │ %dx%d ", chanName, modeTag, w, h)
-	sr := []rune(statText)
-	if pad := w - len(sr); pad > 0 {
-		statText += strings.Repeat(" ", pad)
-	} else if pad := w - len(sr); pad < 0 {
-		statText = string(sr[:w])
+	// The hotlist goes first so a narrow terminal clips the size instead
+	statText := " " + chanName + " "
+	if hot != "" {
+		statText += "│ " + hot + " "
+	}
+	statText += fmt.Sprintf("│ %s │ %dx%d ", modeTag, w, h)
+	if away {
+		statText += "│ away "
+	}
+	if scroll > 0 {
+		statText += fmt.Sprintf("│ ▲%d Enter: bottom ", scroll)
 	}
-	f.WriteString(pos(statRow, 1) + bgGreen + fgBlack + bold + statText + rst)
+	if queued > 0 {
+		statText += fmt.Sprintf("│ %d queued ", queued)
+	}
+	if termTag != "" {
+		statText += "│ " + termTag + " "
+	}
+	fr.fill(statRow, 1, w, th.status)
+	fr.put(statRow, 1, th.status, statText, w)
 
 	// ── Input (row H) — single line, cursor on same line ──
 	inRow := h
@@ -793,24 +916,29 @@ func (s *Session) draw() {
 	if len(promptNick) > 15 {
 		promptNick = promptNick[:15]
 	}
-	prompt := fgGreen + bold + promptNick + rst + " » "
-	f.WriteString(pos(inRow, 1) + clrLine + prompt)
-
-	// Set scroll region to rows 1..H-1 so Enter on row H can't scroll the layout
-	if h > 2 {
-		f.WriteString(fmt.Sprintf("\033[1;%dr", h-1))
+	prompt := th.prompt + promptNick + rst + " » "
+	promptVis := len([]rune(promptNick)) + 3 // "nick » "
+	if pastePrompt != "" {
+		prompt = th.highlight + pastePrompt + rst
+		promptVis = len([]rune(pastePrompt))
 	}
+	fr.put(inRow, 1, "", prompt, w)
 
 	// Position cursor right after the prompt on the input line
-	promptVis := len([]rune(promptNick)) + 3 // "nick » "
-	f.WriteString(pos(inRow, promptVis+1) + showCur)
-
-	s.raw(f.String())
+	s.flush(fr, inRow, promptVis+1, alerts)
 }
 
 // ── Input handling ──
 
 func (s *Session) handleInput(text string) {
+	s.mu.Lock()
+	inList := s.activeList() != nil
+	s.mu.Unlock()
+	if inList && (!strings.HasPrefix(text, "/") || strings.HasPrefix(text, "/sort")) {
+		s.listInput(text)
+		return
+	}
+
 	if !strings.HasPrefix(text, "/") {
 		s.mu.Lock()
 		ac := s.activeChan()
@@ -825,11 +953,7 @@ func (s *Session) handleInput(text string) {
 			return
 		}
 
-		s.ircSend(fmt.Sprintf("PRIVMSG %s :%s", name, text))
-		col := nickColor(s.nick)
-		s.mu.Lock()
-		ac.addMsg(s.fmtMsg(col+"<%s>"+rst+" %s", s.nick, text))
-		s.mu.Unlock()
+		s.say(ac, name, text, false)
 		s.draw()
 		return
 	}
@@ -853,14 +977,10 @@ func (s *Session) handleInput(text string) {
 		s.conn.Close()
 
 	case "/join", "/j":
-		if arg == "" {
-			return
-		}
-		ch := strings.Fields(arg)[0]
-		if !strings.HasPrefix(ch, "#") {
-			ch = "#" + ch
-		}
-		s.ircSend("JOIN " + ch)
+		s.cmdJoin(arg)
+
+	case "/knock":
+		s.cmdKnock(arg)
 
 	case "/part", "/leave":
 		s.mu.Lock()
@@ -878,7 +998,6 @@ func (s *Session) handleInput(text string) {
 		s.mu.Lock()
 		s.removeChan(target)
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/sw", "/switch", "/w":
@@ -892,14 +1011,33 @@ func (s *Session) handleInput(text string) {
 			s.switchTo(arg)
 		}
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/nick":
 		if arg != "" {
 			s.ircSend("NICK " + arg)
+		} else {
+			s.mu.Lock()
+			s.activeChan().addMsg(s.fmtMsg(fgGrey+"You are "+fgGreen+bold+"%s"+rst, s.nick))
+			s.mu.Unlock()
+			s.draw()
 		}
 
+	case "/ignore":
+		s.cmdIgnore(arg)
+
+	case "/unignore":
+		s.cmdUnignore(arg)
+
+	case "/away":
+		s.cmdAway(arg)
+
+	case "/back":
+		s.cmdBack()
+
+	case "/ghost", "/regain":
+		s.cmdRecover(cmd, arg)
+
 	case "/me":
 		if arg == "" {
 			return
@@ -911,10 +1049,7 @@ func (s *Session) handleInput(text string) {
 		if name == "*status" {
 			return
 		}
-		s.ircSend(fmt.Sprintf("PRIVMSG %s :\x01ACTION %s\x01", name, arg))
-		s.mu.Lock()
-		ac.addMsg(s.fmtMsg(fgMagenta+"* %s %s"+rst, s.nick, arg))
-		s.mu.Unlock()
+		s.say(ac, name, arg, true)
 		s.draw()
 
 	case "/msg":
@@ -925,19 +1060,54 @@ func (s *Session) handleInput(text string) {
 			pm := s.getOrMakeChan(target)
 			s.mu.Unlock()
 			if len(p) == 2 && p[1] != "" {
-				s.ircSend(fmt.Sprintf("PRIVMSG %s :%s", target, p[1]))
-				col := nickColor(s.nick)
-				s.mu.Lock()
-				pm.addMsg(s.fmtMsg(col+"<%s>"+rst+" %s", s.nick, p[1]))
-				s.mu.Unlock()
+				s.say(pm, target, p[1], false)
 			}
 			s.mu.Lock()
 			s.switchTo(target)
 			s.mu.Unlock()
-			s.raw(clrScr)
 			s.draw()
 		}
 
+	case "/ctcp":
+		s.cmdCTCP(arg)
+
+	case "/ping":
+		if arg != "" {
+			s.cmdCTCP(strings.Fields(arg)[0] + " PING")
+		}
+
+	case "/whois", "/wi":
+		s.cmdWhois(arg, false)
+
+	case "/whowas":
+		s.cmdWhois(arg, true)
+
+	case "/who":
+		s.cmdWho(arg)
+
+	case "/list":
+		s.cmdList(arg)
+
+	case "/op", "/deop", "/voice", "/devoice", "/ban", "/unban",
+		"/kick", "/kickban", "/kb", "/mode", "/invite":
+		s.cmdOp(cmd, arg)
+
+	case "/banlist", "/exceptlist", "/invitelist":
+		s.cmdMaskList(cmd, arg)
+
+	case "/set":
+		s.cmdSet(arg)
+
+	case "/quote":
+		s.cmdQuote(arg)
+
+	case "/raw":
+		if arg == "" {
+			s.toggleRaw()
+		} else {
+			s.cmdQuote(arg)
+		}
+
 	case "/query", "/q":
 		if arg == "" {
 			return
@@ -947,7 +1117,6 @@ func (s *Session) handleInput(text string) {
 		s.getOrMakeChan(target)
 		s.switchTo(target)
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/close":
@@ -963,7 +1132,6 @@ func (s *Session) handleInput(text string) {
 		s.mu.Lock()
 		s.removeChan(name)
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/topic":
@@ -971,7 +1139,9 @@ func (s *Session) handleInput(text string) {
 		name := s.activeChan().name
 		s.mu.Unlock()
 		if name != "*status" {
-			if arg != "" {
+			if arg == "-h" {
+				s.topicHistory()
+			} else if arg != "" {
 				s.ircSend(fmt.Sprintf("TOPIC %s :%s", name, arg))
 			} else {
 				s.ircSend("TOPIC " + name)
@@ -987,7 +1157,6 @@ func (s *Session) handleInput(text string) {
 		}
 		s.activeChan().addMsg(s.fmtMsg(fgGrey+"Nicklist "+vis+" [/nl]"+rst))
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/chanlist", "/cl":
@@ -999,7 +1168,6 @@ func (s *Session) handleInput(text string) {
 		}
 		s.activeChan().addMsg(s.fmtMsg(fgGrey+"Channel list "+vis+" [/cl]"+rst))
 		s.mu.Unlock()
-		s.raw(clrScr)
 		s.draw()
 
 	case "/nup":
@@ -1039,9 +1207,24 @@ func (s *Session) handleInput(text string) {
 		s.mu.Unlock()
 		s.draw()
 
+	case "/hl":
+		s.cmdHL(arg)
+
+	case "/next":
+		s.cmdNext()
+
+	case "/filter":
+		s.cmdFilter(arg)
+
+	case "/netsplit":
+		s.cmdNetsplit(arg)
+
+	case "/theme":
+		s.cmdTheme(arg)
+
 	case "/redraw", "/rd":
 		s.querySize()
-		s.raw(clrScr)
+		s.invalidate()
 		s.draw()
 
 	case "/resize":
@@ -1054,21 +1237,47 @@ func (s *Session) handleInput(text string) {
 	case "/help":
 		help := []string{
 			fgCyan + bold + "── Commands ──" + rst,
-			fgGreen + " /join #channel  " + rst + " Join a channel",
+			fgGreen + " /join #chan [k] " + rst + " Join a channel",
+			fgGreen + " /knock #chan    " + rst + " Ask for an invite (+i)",
 			fgGreen + " /part [#chan]    " + rst + " Leave channel/close PM",
 			fgGreen + " /sw <N|#chan>    " + rst + " Switch window",
 			fgGreen + " /nick <name>    " + rst + " Change nick",
+			fgGreen + " /regain <nick>  " + rst + " Reclaim your nick (/ghost)",
+			fgGreen + " /away [msg]     " + rst + " Mark yourself away (/back)",
+			fgGreen + " /ignore [mask]  " + rst + " List/add ignores (/unignore)",
 			fgGreen + " /me <action>    " + rst + " Action message",
 			fgGreen + " /msg <to> [txt] " + rst + " Open PM (optional msg)",
 			fgGreen + " /query <nick>   " + rst + " Open PM window",
 			fgGreen + " /close          " + rst + " Close current window",
-			fgGreen + " /topic [text]   " + rst + " View/set topic",
+			fgGreen + " /topic [text]   " + rst + " View/set topic (-h history)",
+			fgGreen + " /whois <nick>   " + rst + " User info (/whowas too)",
+			fgGreen + " /who [mask]     " + rst + " List matching users",
+			fgGreen + " /list [filter]  " + rst + " Browse channels",
+			fgGreen + " /ctcp <n> <cmd> " + rst + " Send a CTCP request",
+			fgGreen + " /ping <nick>    " + rst + " CTCP ping round trip",
+			fgCyan + bold + "── Operators ──" + rst,
+			fgGreen + " /op /deop <n..> " + rst + " Give/take ops",
+			fgGreen + " /voice /devoice " + rst + " Give/take voice",
+			fgGreen + " /kick <n> [why] " + rst + " Kick from channel",
+			fgGreen + " /ban /unban     " + rst + " Ban nick or mask",
+			fgGreen + " /kickban <n>    " + rst + " Ban then kick",
+			fgGreen + " /mode [t] <m>   " + rst + " Set modes",
+			fgGreen + " /invite <n> [c] " + rst + " Invite to channel",
+			fgGreen + " /banlist [-d N] " + rst + " Bans (/exceptlist, /invitelist)",
 			fgCyan + bold + "── Panels ──" + rst,
 			fgGreen + " /nl             " + rst + " Toggle nicklist",
 			fgGreen + " /cl             " + rst + " Toggle channel list",
 			fgGreen + " /nup [N]        " + rst + " Scroll nicks up",
 			fgGreen + " /nd [N]         " + rst + " Scroll nicks down",
+			fgGreen + " /hl [N]         " + rst + " Jump to a highlight",
+			fgGreen + " /next           " + rst + " Next active window (Alt-A)",
+			fgGreen + " /filter [k] [v] " + rst + " Join/part filter for this channel",
+			fgGreen + " /netsplit [N]   " + rst + " Recent netsplits / who split",
 			fgCyan + bold + "── Other ──" + rst,
+			fgGreen + " /theme [name]   " + rst + " List/switch color theme",
+			fgGreen + " /set [opt] [v]  " + rst + " View/change settings",
+			fgGreen + " /quote <line>   " + rst + " Send raw IRC line",
+			fgGreen + " /raw            " + rst + " Toggle raw protocol log",
 			fgGreen + " /rd             " + rst + " Redraw screen",
 			fgGreen + " /resize         " + rst + " Re-detect term size",
 			fgGreen + " /quit           " + rst + " Disconnect",
@@ -1098,8 +1307,8 @@ func (s *Session) run() {
 
 	cr := &clientReader{conn: s.conn, sess: s}
 
-	// Telnet NAWS negotiation
-	s.conn.Write([]byte{iacByte, iacDO, optNAWS})
+	// Telnet NAWS, TERMINAL-TYPE and NEW-ENVIRON negotiation
+	cr.negotiate()
 
 	// ANSI cursor position report
 	s.querySize()
@@ -1116,8 +1325,11 @@ func (s *Session) run() {
 		cr.extractCPR()
 		s.mu.Lock()
 		gotSize := s.w != defW || s.h != defH
+		gotEnv := s.gotEnv
 		s.mu.Unlock()
-		if gotSize {
+		// The environment may carry the nick, so give it the same time
+		envOpt := cr.tel.opts[optNEWENV].him
+		if gotSize && (gotEnv || envOpt == qNo) {
 			break
 		}
 	}
@@ -1144,9 +1356,15 @@ func (s *Session) run() {
 		// extractCPR inside ReadLine should have detected the size by now
 	}
 
+	// Start rendering; anything drawn during negotiation shows up now
+	quit := make(chan struct{})
+	defer close(quit)
+	go s.renderLoop(quit)
+	go s.autoAwayLoop(quit)
+
 	// Initial draw with (hopefully) correct size
-	s.raw(clrScr)
 	s.mu.Lock()
+	s.envNicks()
 	s.serverCh.addMsg(s.fmtMsg(fgGrey+"Connecting to "+fgWhite+bold+ircAddr+rst+fgGrey+" as "+fgGreen+s.nick+rst+fgGrey+"..."+rst))
 	s.mu.Unlock()
 	s.draw()
@@ -1163,7 +1381,12 @@ func (s *Session) run() {
 	}
 	s.irc = irc
 	defer irc.Close()
+	go s.ircWriter()
 
+	s.mu.Lock()
+	s.wantNick = s.nick
+	s.mu.Unlock()
+	s.ircSend("CAP LS 302")
 	s.ircSend("NICK " + s.nick)
 	s.ircSend("USER tunnel 0 * :Tunnel User")
 
@@ -1181,17 +1404,25 @@ func (s *Session) run() {
 				return
 			}
 			rawLine := sc.Text()
+			s.logRaw(rawLine, false)
 			m := parseIRC(rawLine)
+			m.stripControls()
+			quiet := false // from an ignored user: update state, print nothing
+			if strings.Contains(m.prefix, "!") {
+				s.mu.Lock()
+				s.seenPrefix(m.prefix)
+				quiet = s.ignored(m)
+				s.mu.Unlock()
+			}
+			if quiet && (m.command == "PRIVMSG" || m.command == "NOTICE" || m.command == "INVITE") {
+				continue
+			}
 
 			// Route numeric server replies to status window
 			isNum := len(m.command) >= 3 && m.command[0] >= '0' && m.command[0] <= '9'
-			if isNum && m.command != "353" && m.command != "366" {
+			if isNum && !quietNumerics[m.command] {
 				s.mu.Lock()
-				display := m.trail()
-				if display == "" {
-					display = strings.Join(m.params, " ")
-				}
-				s.addMsgTo(s.serverCh, s.fmtMsg(fgGrey+"["+m.command+"]"+rst+" %s", display))
+				s.showNumeric(m)
 				s.mu.Unlock()
 			}
 
@@ -1202,10 +1433,13 @@ func (s *Session) run() {
 			case "001":
 				if !joined {
 					joined = true
-					s.ircSend("JOIN " + defChan)
+					s.sendq.registered()
 					s.mu.Lock()
+					join := s.joinLine(defChan)
+					s.registered = true
 					s.serverCh.addMsg(s.fmtMsg(fgGreen + bold + "Connected! Type /help for commands" + rst))
 					s.mu.Unlock()
+					s.ircSend(join)
 					s.draw()
 				}
 
@@ -1216,23 +1450,100 @@ func (s *Session) run() {
 					s.mu.Lock()
 					if c := s.getChan(chName); c != nil {
 						c.mode = mode
+						if key, ok := s.chanKey(m.params[2:]); !ok {
+							c.key = ""
+						} else if key != "" && key != "*" {
+							c.key = key
+						}
 					}
 					s.mu.Unlock()
 					s.draw()
 				}
 
-			case "332": // RPL_TOPIC
+			case "311", "312", "313", "314", "317", "319", "330", "338", "671",
+				"276", "307", "320", "378", "379": // WHOIS / WHOWAS reply lines
+				s.whoisNumeric(m)
+
+			case "318", "369": // RPL_ENDOFWHOIS, RPL_ENDOFWHOWAS
+				s.whoisEnd(m)
+
+			case "301": // RPL_AWAY
+				s.mu.Lock()
+				inWhois := len(m.params) >= 2 && s.whoisPending(m.params[1])
+				s.mu.Unlock()
+				if inWhois {
+					s.whoisNumeric(m)
+				} else {
+					s.awayReply(m)
+				}
+
+			case "305", "306": // RPL_UNAWAY, RPL_NOWAWAY
+				s.selfAway(m)
+
+			case "CAP":
+				s.capMsg(m)
+
+			case "AWAY": // away-notify
+				s.userAway(m)
+
+			case "401", "406": // ERR_NOSUCHNICK, ERR_WASNOSUCHNICK
+				s.whoisError(m)
+
+			case "352": // RPL_WHOREPLY
+				s.whoReply(m)
+
+			case "315": // RPL_ENDOFWHO
+				s.whoEnd(m)
+
+			case "005": // RPL_ISUPPORT
+				s.mu.Lock()
+				s.parseISupport(m)
+				s.mu.Unlock()
+
+			case "322": // RPL_LIST
+				s.listReply(m)
+
+			case "323": // RPL_LISTEND
+				s.listEnd()
+
+			case "367": // RPL_BANLIST
+				s.maskEntryReply(m, "ban")
+			case "348": // RPL_EXCEPTLIST
+				s.maskEntryReply(m, "exception")
+			case "346": // RPL_INVITELIST
+				s.maskEntryReply(m, "invite")
+			case "368": // RPL_ENDOFBANLIST
+				s.maskListEnd(m, "ban", "/banlist")
+			case "349": // RPL_ENDOFEXCEPTLIST
+				s.maskListEnd(m, "exception", "/exceptlist")
+			case "347": // RPL_ENDOFINVITELIST
+				s.maskListEnd(m, "invite", "/invitelist")
+
+			case "471", "473", "474", "475", "477", "489", "403", "405": // join failures
+				s.joinFailed(m)
+
+			case "482": // ERR_CHANOPRIVSNEEDED
+				s.chanOpNeeded(m)
+
+			case "396": // RPL_HOSTHIDDEN
 				if len(m.params) >= 2 {
-					chName := m.params[1]
-					topic := m.trail()
 					s.mu.Lock()
-					if c := s.getChan(chName); c != nil {
-						c.topic = topic
-					}
+					s.setHiddenHost(m.params[1])
 					s.mu.Unlock()
-					s.draw()
 				}
 
+			case "332", "331": // RPL_TOPIC, RPL_NOTOPIC
+				s.topicReply(m)
+
+			case "333": // RPL_TOPICWHOTIME
+				s.topicWhoTime(m)
+
+			case "329": // RPL_CREATIONTIME
+				s.creationTime(m)
+
+			case "TOPIC":
+				s.topicChanged(m)
+
 			case "353": // RPL_NAMREPLY (silent — no status dump)
 				var chName string
 				for _, p := range m.params {
@@ -1257,15 +1568,11 @@ func (s *Session) run() {
 			case "366": // RPL_ENDOFNAMES (silent)
 				s.draw()
 
-			case "433": // ERR_NICKNAMEINUSE
-				s.mu.Lock()
-				s.nick = randNick()
-				s.mu.Unlock()
-				s.ircSend("NICK " + s.nick)
-				s.mu.Lock()
-				s.serverCh.addMsg(s.fmtMsg(fgGrey+"Nick taken, trying "+fgGreen+s.nick+rst))
-				s.mu.Unlock()
-				s.draw()
+			case "432", "433", "436", "437": // erroneous, in use, collision, unavailable
+				s.nickError(m)
+
+			case "900", "901": // RPL_LOGGEDIN, RPL_LOGGEDOUT
+				s.loggedIn(m)
 
 			case "JOIN":
 				who := m.nick()
@@ -1275,21 +1582,31 @@ func (s *Session) run() {
 				}
 				if strings.EqualFold(who, s.nick) {
 					s.mu.Lock()
+					s.setUserHost(m.prefix)
 					c := s.getOrMakeChan(chName)
 					c.nicks = make(map[string]string)
+					s.joined(c)
 					c.addMsg(s.fmtMsg(fgGrey+"Joined "+fgCyan+bold+chName+rst))
 					c.addMsg(s.fmtMsg(fgGrey+"Type to chat │ /help for commands"+rst))
 					s.switchTo(chName)
+					seedAway := s.hasCap("away-notify")
+					if seedAway {
+						s.whoQ = append(s.whoQ, &whoReq{mask: chName, ch: c, silent: true})
+					}
 					s.mu.Unlock()
 					// Request channel mode
 					s.ircSend("MODE " + chName)
-					s.raw(clrScr)
+					if seedAway {
+						s.ircSend("WHO " + chName) // initial away flags
+					}
 					s.draw()
 				} else {
 					s.mu.Lock()
 					if c := s.getChan(chName); c != nil {
 						c.nicks[strings.ToLower(who)] = who
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"→ %s joined"+rst, who))
+						if !quiet && !s.splitJoin(c, who) {
+							s.eventLine(c, who, "joined", who, s.fmtMsg(roleJoin+"→ %s joined"+rst, who))
+						}
 					}
 					s.mu.Unlock()
 					s.draw()
@@ -1305,13 +1622,14 @@ func (s *Session) run() {
 					s.mu.Lock()
 					s.removeChan(chName)
 					s.mu.Unlock()
-					s.raw(clrScr)
 					s.draw()
 				} else {
 					s.mu.Lock()
 					if c := s.getChan(chName); c != nil {
 						delete(c.nicks, strings.ToLower(who))
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"← %s left"+rst, who))
+						if !quiet {
+							s.eventLine(c, who, "left", who, s.fmtMsg(roleJoin+"← %s left"+rst, who))
+						}
 					}
 					s.mu.Unlock()
 					s.draw()
@@ -1321,12 +1639,18 @@ func (s *Session) run() {
 				who := m.nick()
 				reason := m.trail()
 				s.mu.Lock()
-				for _, c := range s.chansWithNick(who) {
+				delete(s.users, strings.ToLower(who))
+				chans := s.chansWithNick(who)
+				for _, c := range chans {
 					delete(c.nicks, strings.ToLower(who))
-					if reason != "" {
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"← %s quit (%s)"+rst, who, reason))
-					} else {
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"← %s quit"+rst, who))
+				}
+				if !quiet && !s.splitQuit(who, reason, chans) {
+					for _, c := range chans {
+						if reason != "" {
+							s.eventLine(c, who, "quit", who, s.fmtMsg(roleJoin+"← %s quit (%s)"+rst, who, reason))
+						} else {
+							s.eventLine(c, who, "quit", who, s.fmtMsg(roleJoin+"← %s quit"+rst, who))
+						}
 					}
 				}
 				s.mu.Unlock()
@@ -1343,6 +1667,9 @@ func (s *Session) run() {
 				isAction := strings.HasPrefix(msg, "\x01ACTION ") && strings.HasSuffix(msg, "\x01")
 				if isAction {
 					msg = msg[8 : len(msg)-1]
+				} else if cmd, args, ok := parseCTCP(msg); ok {
+					s.handleCTCP(sender, target, cmd, args)
+					continue
 				}
 
 				s.mu.Lock()
@@ -1352,26 +1679,37 @@ func (s *Session) run() {
 						s.mu.Unlock()
 						continue
 					}
-					if isAction {
-						s.addMsgTo(c, s.fmtMsg(fgMagenta+"* %s %s"+rst, sender, msg))
-					} else if !strings.EqualFold(sender, s.nick) {
+					s.spoke(c, sender)
+					hl := !strings.EqualFold(sender, s.nick) && s.highlights(msg)
+					switch {
+					case isAction && hl:
+						s.addChatTo(c, s.fmtMsg(roleHL+"* %s %s"+rst, sender, msg))
+					case isAction:
+						s.addChatTo(c, s.fmtMsg(roleAction+"* %s %s"+rst, sender, msg))
+					case hl:
+						s.addChatTo(c, s.fmtMsg(roleHL+"<%s> %s"+rst, sender, msg))
+					case !strings.EqualFold(sender, s.nick):
 						col := nickColor(sender)
-						s.addMsgTo(c, s.fmtMsg(col+"<%s>"+rst+" %s", sender, msg))
-						if strings.Contains(strings.ToLower(msg), strings.ToLower(s.nick)) && c != s.activeChan() {
-							c.highlight = true
+						s.addChatTo(c, s.fmtMsg(col+"<%s>"+rst+" %s", sender, msg))
+					}
+					if hl {
+						s.noteHighlight(c, sender, msg)
+						if c != s.activeChan() {
+							c.highlight++
 						}
 					}
 				} else if strings.EqualFold(target, s.nick) {
 					// Incoming PM — open/find PM window for sender
 					pm := s.getOrMakeChan(sender)
 					if isAction {
-						s.addMsgTo(pm, s.fmtMsg(fgMagenta+"* %s %s"+rst, sender, msg))
+						s.addChatTo(pm, s.fmtMsg(roleAction+"* %s %s"+rst, sender, msg))
 					} else {
 						col := nickColor(sender)
-						s.addMsgTo(pm, s.fmtMsg(col+"<%s>"+rst+" %s", sender, msg))
+						s.addChatTo(pm, s.fmtMsg(col+"<%s>"+rst+" %s", sender, msg))
 					}
+					s.noteHighlight(pm, sender, msg)
 					if pm != s.activeChan() {
-						pm.highlight = true
+						pm.highlight++
 					}
 				}
 				s.mu.Unlock()
@@ -1379,12 +1717,16 @@ func (s *Session) run() {
 
 			case "NOTICE":
 				sender := m.nick()
+				if cmd, args, ok := parseCTCP(m.trail()); ok && strings.Contains(m.prefix, "!") {
+					s.ctcpReply(sender, cmd, args)
+					continue
+				}
 				s.mu.Lock()
 				// Server notices (no ! in prefix) → status, user notices → active
 				if !strings.Contains(m.prefix, "!") {
-					s.addMsgTo(s.serverCh, s.fmtMsg(fgYellow+"-%s-"+rst+" %s", sender, m.trail()))
+					s.addChatTo(s.serverCh, s.fmtMsg(roleNotice+"-%s-"+rst+" %s", sender, m.trail()))
 				} else {
-					s.activeChan().addMsg(s.fmtMsg(fgYellow+"-%s-"+rst+" %s", sender, m.trail()))
+					s.activeChan().addMsg(s.fmtMsg(roleNotice+"-%s-"+rst+" %s", sender, m.trail()))
 				}
 				s.mu.Unlock()
 				s.draw()
@@ -1395,6 +1737,9 @@ func (s *Session) run() {
 				if newN == "" && len(m.params) > 0 {
 					newN = m.params[0]
 				}
+				s.mu.Lock()
+				s.renameUser(who, newN)
+				s.mu.Unlock()
 				if strings.EqualFold(who, s.nick) {
 					s.mu.Lock()
 					s.nick = newN
@@ -1416,7 +1761,12 @@ func (s *Session) run() {
 							delete(c.nicks, old)
 						}
 						c.nicks[strings.ToLower(newN)] = pfx + newN
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"%s → %s"+rst, who, newN))
+						if t, ok := c.lastSpoke[old]; ok {
+							c.lastSpoke[strings.ToLower(newN)] = t
+						}
+						if !quiet {
+							s.eventLine(c, who, "nick", who+" → "+newN, s.fmtMsg(roleJoin+"%s → %s"+rst, who, newN))
+						}
 					}
 					s.mu.Unlock()
 				}
@@ -1432,15 +1782,14 @@ func (s *Session) run() {
 				if strings.EqualFold(kicked, s.nick) {
 					s.mu.Lock()
 					if c := s.getChan(chName); c != nil {
-						c.addMsg(s.fmtMsg(fgRed+bold+"Kicked! (%s) Rejoining..."+rst, reason))
+						s.kicked(c, m.nick(), reason)
 					}
 					s.mu.Unlock()
-					s.ircSend("JOIN " + chName)
 				} else {
 					s.mu.Lock()
 					if c := s.getChan(chName); c != nil {
 						delete(c.nicks, strings.ToLower(kicked))
-						s.addMsgTo(c, s.fmtMsg(fgGrey+"← %s kicked (%s)"+rst, kicked, reason))
+						s.addMsgTo(c, s.fmtMsg(roleJoin+"← %s kicked (%s)"+rst, kicked, reason))
 					}
 					s.mu.Unlock()
 				}
@@ -1483,15 +1832,53 @@ func (s *Session) run() {
 		if err != nil || !s.alive {
 			break
 		}
+		s.idle()
 
 		// Immediately clear the input line to remove terminal echo artifacts
 		s.mu.Lock()
 		inRow := s.h
+		cs := s.charset
 		s.mu.Unlock()
 		s.raw(pos(inRow, 1) + clrLine)
+		s.staleRow(inRow)
+
+		// A held paste waits for y/N before anything else
+		s.mu.Lock()
+		held := s.paste != nil
+		s.mu.Unlock()
+		if held {
+			s.answerPaste(line)
+			continue
+		}
+
+		if more := cr.burst(); len(more) > 0 {
+			var pasted []string
+			for _, l := range append([]string{line}, more...) {
+				l, _, _ = parseArrows(l)
+				if l = strings.TrimSpace(decodeInput(cs, l)); l != "" {
+					pasted = append(pasted, l)
+				}
+			}
+			if len(pasted) >= pasteMin {
+				s.holdPaste(pasted)
+				continue
+			}
+			if len(pasted) == 1 {
+				line = pasted[0]
+			}
+		}
+
+		if rest, ok := altA(line); ok && strings.TrimSpace(rest) == "" {
+			s.cmdNext()
+			continue
+		}
 
 		cleaned, ups, downs := parseArrows(line)
-		cleaned = strings.TrimSpace(cleaned)
+		cleaned = strings.TrimSpace(decodeInput(cs, cleaned))
+
+		if cleaned == "" && (ups > 0 || downs > 0) && s.listKeys(ups, downs) {
+			continue
+		}
 
 		if cleaned == "" && (ups > 0 || downs > 0) {
 			// Pure arrow key input — history navigation
@@ -1522,13 +1909,19 @@ func (s *Session) run() {
 			s.raw(pos(inRow, 1) + clrLine +
 				fgGreen + bold + promptNick + rst + " » " +
 				fgYellow + recalled + rst)
+			s.staleRow(inRow)
 
 			s.handleInput(recalled)
 			continue
 		}
 
 		if cleaned == "" {
-			s.draw()
+			if !s.listEnter() {
+				s.mu.Lock()
+				s.activeChan().scroll = 0 // back to the bottom after /hl
+				s.mu.Unlock()
+				s.draw()
+			}
 			continue
 		}
 
@@ -1541,11 +1934,13 @@ func (s *Session) run() {
 
 	s.alive = false
 	s.ircSend("QUIT :Client disconnected")
+	s.sendq.stop()
 	s.irc.Close()
 	<-done
 }
 
 func main() {
+	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
 	ln, err := net.Listen("tcp", listen)
 	if err != nil {
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestStripControls(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain text", "plain text"},
+		{"role \033[205;9223372036854775808m code", "role [205;9223372036854775808m code"},
+		{"\x02bold\x0f \x1funder\x1f", "bold under"},
+		{"\x0304,12red\x03 \x0399x \x031,y", "red x ,y"},
+		{"\x01ACTION waves\x01", "\x01ACTION waves\x01"},
+		{"c1 \u009b31m csi", "c1 31m csi"},
+		{"bell\a del\x7f", "bell del"},
+	}
+	for _, tt := range tests {
+		m := parseIRC(":n!u@h PRIVMSG #c :" + tt.in)
+		m.stripControls()
+		if got := m.trail(); got != tt.want {
+			t.Errorf("stripControls(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Ban / exception / invite lists ──
+// /banlist, /exceptlist and /invitelist collect 367/348/346 into a numbered
+// table; "-d N [N...]" removes entries by their number in the last table.
+
+type maskEntry struct {
+	mask, setter string
+	set          time.Time
+}
+
+type maskList struct {
+	name    string // ban, exception, invite
+	entries []maskEntry
+	done    bool
+	win     *Channel // window to print into
+}
+
+// maskKinds maps each list command to its default mode letter and the
+// ISUPPORT token that can rename it.
+var maskKinds = map[string]struct {
+	name  string
+	mode  byte
+	token string
+}{
+	"/banlist":    {"ban", 'b', ""},
+	"/exceptlist": {"exception", 'e', "EXCEPTS"},
+	"/invitelist": {"invite", 'I', "INVEX"},
+}
+
+func maskKey(ch, name string) string { return name + " " + strings.ToLower(ch) }
+
+// maskMode returns the mode letter for a list kind on this server.
+// (call with mu held)
+func (s *Session) maskMode(cmd string) byte {
+	k := maskKinds[cmd]
+	if k.token != "" {
+		if v, ok := s.support(k.token); ok && v != "" {
+			return v[0]
+		}
+	}
+	return k.mode
+}
+
+func (s *Session) cmdMaskList(cmd, arg string) {
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	ch := s.activeChan().name
+	if len(f) > 0 && strings.HasPrefix(f[0], "#") {
+		ch, f = f[0], f[1:]
+	}
+	k := maskKinds[cmd]
+	mode := s.maskMode(cmd)
+	s.mu.Unlock()
+	if !strings.HasPrefix(ch, "#") {
+		s.opNote("Usage: %s [#channel] [-d N...]", cmd)
+		return
+	}
+
+	if len(f) > 0 && f[0] == "-d" {
+		s.mu.Lock()
+		l := s.maskLists[maskKey(ch, k.name)]
+		var masks []string
+		var bad []string
+		for _, n := range f[1:] {
+			i, err := strconv.Atoi(n)
+			if l == nil || err != nil || i < 1 || i > len(l.entries) {
+				bad = append(bad, n)
+				continue
+			}
+			masks = append(masks, l.entries[i-1].mask)
+		}
+		s.mu.Unlock()
+		if l == nil {
+			s.opNote("No %s list for %s yet, run %s first", k.name, ch, cmd)
+			return
+		}
+		if len(bad) > 0 {
+			s.opNote("No %s list entry %s (1-%d)", k.name, strings.Join(bad, ", "), len(l.entries))
+		}
+		if len(masks) > 0 {
+			s.sendModes(ch, "-", mode, masks)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.maskLists[maskKey(ch, k.name)] = &maskList{name: k.name, win: s.activeChan()}
+	s.mu.Unlock()
+	s.ircSend(fmt.Sprintf("MODE %s %c", ch, mode))
+}
+
+// maskEntryReply adds one 367/348/346 line. Lists nobody asked for (e.g. a
+// raw MODE +b) are printed in the channel's window. (call without mu held)
+func (s *Session) maskEntryReply(m ircMsg, name string) {
+	// me channel mask [setter [time]]
+	if len(m.params) < 3 {
+		return
+	}
+	p := m.params
+	s.mu.Lock()
+	key := maskKey(p[1], name)
+	l := s.maskLists[key]
+	if l == nil || l.done {
+		win := s.getChan(p[1])
+		if win == nil {
+			win = s.activeChan()
+		}
+		l = &maskList{name: name, win: win}
+		s.maskLists[key] = l
+	}
+	e := maskEntry{mask: p[2]}
+	if len(p) >= 4 {
+		e.setter = p[3]
+	}
+	if len(p) >= 5 {
+		if ts := simpleAtoi(p[4]); ts > 0 {
+			e.set = time.Unix(int64(ts), 0)
+		}
+	}
+	l.entries = append(l.entries, e)
+	s.mu.Unlock()
+}
+
+// maskListEnd prints the collected list on 368/349/347. (call without mu held)
+func (s *Session) maskListEnd(m ircMsg, name, cmd string) {
+	if len(m.params) < 2 {
+		return
+	}
+	ch := m.params[1]
+	s.mu.Lock()
+	key := maskKey(ch, name)
+	l := s.maskLists[key]
+	if l == nil || l.done {
+		win := s.getChan(ch)
+		if win == nil {
+			win = s.activeChan()
+		}
+		l = &maskList{name: name, win: win}
+		s.maskLists[key] = l
+	}
+	l.done = true
+	title := strings.ToUpper(name[:1]) + name[1:]
+	if len(l.entries) == 0 {
+		s.addMsgTo(l.win, s.fmtMsg(fgGrey+"%s list for %s is empty"+rst, title, ch))
+	} else {
+		s.addMsgTo(l.win, s.fmtMsg(fgCyan+bold+"── %s list %s ── "+rst+fgGrey+"%d entries"+rst, title, ch, len(l.entries)))
+		for i, e := range l.entries {
+			setter, when := e.setter, ""
+			if j := strings.IndexByte(setter, '!'); j > 0 {
+				setter = setter[:j]
+			}
+			if !e.set.IsZero() {
+				when = e.set.Format("2006-01-02 15:04")
+			}
+			s.addMsgTo(l.win, s.fmtMsg(fgGreen+"%3d"+rst+" %-36s "+fgGrey+"%-16s %s"+rst, i+1, e.mask, setter, when))
+		}
+		s.addMsgTo(l.win, s.fmtMsg(fgCyan+"── %s %s -d N removes an entry ──"+rst, cmd, ch))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
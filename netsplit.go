@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Netsplits ──
+// QUITs whose reason is two server names are gathered into one
+// "Netsplit a.net <-> b.net" line per channel that counts up as they
+// arrive; rejoins of those users after the netjoin collapse the same way.
+// Users the smart filter would hide are left out like their plain quits.
+// /netsplit lists recent splits and /netsplit N the nicks involved.
+
+const (
+	splitGap    = 2 * time.Minute  // quits further apart start a new split
+	netjoinWait = 30 * time.Minute // how long we wait for split users to return
+	maxSplits   = 10
+)
+
+// Server names, plain or masked as on some networks ("*.net *.split").
+var splitReason = regexp.MustCompile(`^[\w*-]+(\.[\w*-]+)+ [\w*-]+(\.[\w*-]+)+$`)
+
+type netsplit struct {
+	id       int
+	servers  [2]string
+	at, last time.Time
+	chans    map[string]*splitChan // by lowercase channel name
+	quits    int
+	back     int
+}
+
+type splitChan struct {
+	name               string
+	quit, back         []string
+	gone               map[string]bool // lowercase nicks not back yet
+	quitLine, backLine string          // current summary lines, to update them
+}
+
+func (n *netsplit) title() string {
+	return n.servers[0] + " <-> " + n.servers[1]
+}
+
+// findSplit returns the split a quit with this reason belongs to, starting
+// a new one when needed. (call with mu held)
+func (s *Session) findSplit(reason string) *netsplit {
+	for i := len(s.splits) - 1; i >= 0; i-- {
+		n := s.splits[i]
+		if n.servers[0]+" "+n.servers[1] == reason && time.Since(n.last) < splitGap {
+			return n
+		}
+	}
+	a, b, _ := strings.Cut(reason, " ")
+	s.splitSeq++
+	n := &netsplit{
+		id: s.splitSeq, servers: [2]string{a, b}, at: time.Now(),
+		chans: make(map[string]*splitChan),
+	}
+	s.splits = append(s.splits, n)
+	if len(s.splits) > maxSplits {
+		s.splits = s.splits[len(s.splits)-maxSplits:]
+	}
+	return n
+}
+
+// splitHidden reports whether the smart filter would drop who's join or
+// quit in c. (call with mu held)
+func (s *Session) splitHidden(c *Channel, who string) bool {
+	t, ok := c.lastSpoke[strings.ToLower(who)]
+	return s.smartOn(c) && (!ok || time.Since(t) > time.Duration(s.smartMins)*time.Minute)
+}
+
+// splitQuit files a netsplit QUIT; reports false if reason isn't one.
+// (call with mu held)
+func (s *Session) splitQuit(who, reason string, chans []*Channel) bool {
+	if !splitReason.MatchString(reason) {
+		return false
+	}
+	n := s.findSplit(reason)
+	n.last = time.Now()
+	n.quits++
+	low := strings.ToLower(who)
+	for _, c := range chans {
+		if s.splitHidden(c, who) {
+			continue
+		}
+		key := strings.ToLower(c.name)
+		sc := n.chans[key]
+		if sc == nil {
+			sc = &splitChan{name: c.name, gone: make(map[string]bool)}
+			n.chans[key] = sc
+		}
+		sc.quit = append(sc.quit, who)
+		sc.gone[low] = true
+		line := s.fmtMsg(roleJoin+"← Netsplit %s: %d quit%s "+rst+fgGrey+"(/netsplit %d)"+rst,
+			n.title(), len(sc.quit), plural(len(sc.quit)), n.id)
+		if sc.quitLine == "" || !c.replaceMsg(sc.quitLine, line) {
+			s.addMsgTo(c, line)
+		}
+		sc.quitLine = line
+	}
+	return true
+}
+
+// splitJoin files the JOIN of a user who left c in a recent split and
+// hasn't come back yet; reports false otherwise. (call with mu held)
+func (s *Session) splitJoin(c *Channel, who string) bool {
+	low := strings.ToLower(who)
+	for i := len(s.splits) - 1; i >= 0; i-- {
+		n := s.splits[i]
+		sc := n.chans[strings.ToLower(c.name)]
+		if sc == nil || !sc.gone[low] || time.Since(n.last) > netjoinWait {
+			continue
+		}
+		delete(sc.gone, low)
+		sc.back = append(sc.back, who)
+		n.back++
+		line := s.fmtMsg(roleJoin+"→ Netjoin %s: %d of %d back "+rst+fgGrey+"(/netsplit %d)"+rst,
+			n.title(), len(sc.back), len(sc.quit), n.id)
+		if sc.backLine == "" || !c.replaceMsg(sc.backLine, line) {
+			s.addMsgTo(c, line)
+		}
+		sc.backLine = line
+		return true
+	}
+	return false
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// cmdNetsplit lists recent splits, or the nicks of split N.
+func (s *Session) cmdNetsplit(arg string) {
+	arg = strings.TrimSpace(arg)
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	ac := s.activeChan()
+	if len(s.splits) == 0 {
+		ac.addMsg(s.fmtMsg(fgGrey + "No netsplits seen" + rst))
+		return
+	}
+	if arg == "" {
+		ac.addMsg(s.fmtMsg(fgCyan + bold + "── Netsplits ──" + rst))
+		for _, n := range s.splits {
+			ac.addMsg(s.fmtMsg(fgGreen+"%3d"+rst+" %s "+fgGrey+"%s, %d quits, %d rejoins"+rst,
+				n.id, n.title(), n.at.Format("15:04:05"), n.quits, n.back))
+		}
+		return
+	}
+	var n *netsplit
+	for _, x := range s.splits {
+		if fmt.Sprint(x.id) == arg {
+			n = x
+		}
+	}
+	if n == nil {
+		ac.addMsg(s.fmtMsg(fgGrey+"No netsplit %s, /netsplit lists them"+rst, arg))
+		return
+	}
+	// The active channel only, if it was affected
+	var chans []*splitChan
+	if sc, ok := n.chans[strings.ToLower(ac.name)]; ok {
+		chans = append(chans, sc)
+	} else {
+		for _, sc := range n.chans {
+			chans = append(chans, sc)
+		}
+		sort.Slice(chans, func(i, j int) bool { return chans[i].name < chans[j].name })
+	}
+	ac.addMsg(s.fmtMsg(fgCyan+bold+"── Netsplit %d %s ──"+rst+fgGrey+" %s"+rst, n.id, n.title(), n.at.Format("2006-01-02 15:04:05")))
+	for _, sc := range chans {
+		ac.addMsg(s.fmtMsg(fgCyan+"%s"+rst+fgGrey+" quit (%d): "+rst+"%s", sc.name, len(sc.quit), strings.Join(sc.quit, " ")))
+		if len(sc.back) > 0 {
+			ac.addMsg(s.fmtMsg(fgCyan+"%s"+rst+fgGrey+" back (%d): "+rst+"%s", sc.name, len(sc.back), strings.Join(sc.back, " ")))
+		}
+	}
+}
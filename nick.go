@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// ── Nick collisions ──
+// The client picks its nick through telnet's environment: IRCNICK, or USER
+// as sent by telnet -l, with IRCALTNICKS as /set altnicks. During
+// registration a taken nick falls through the altnicks, then the wanted
+// nick with _ suffixes, then a random one. After registration a failed
+// /nick keeps the current nick; /ghost and /regain ask NickServ to free a
+// nick the user's account owns.
+
+const maxSuffix = 3
+
+// validNick reports whether n is a plausible RFC 2812 nick.
+func validNick(n string) bool {
+	if n == "" || len(n) > 30 || n[0] == '-' || n[0] >= '0' && n[0] <= '9' {
+		return false
+	}
+	for _, r := range n {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("[]\\`_^{|}-", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// envNicks takes the registration nick and altnicks from the client's
+// environment, keeping the random nick if none is usable. (call with mu held)
+func (s *Session) envNicks() {
+	for _, k := range []string{"IRCNICK", "USER"} {
+		if n := s.env[k]; validNick(n) {
+			s.nick = n
+			break
+		}
+	}
+	if v := s.env["IRCALTNICKS"]; v != "" && len(s.altNicks) == 0 {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); validNick(n) {
+				s.altNicks = append(s.altNicks, n)
+			}
+		}
+	}
+}
+
+// nextNick picks the next nick to try during registration. (call with mu held)
+func (s *Session) nextNick() string {
+	i := s.nickTry
+	s.nickTry++
+	if i < len(s.altNicks) {
+		return s.altNicks[i]
+	}
+	i -= len(s.altNicks)
+	if i < maxSuffix {
+		return s.wantNick + strings.Repeat("_", i+1)
+	}
+	return randNick()
+}
+
+// nickError handles 432/433/436/437. (call without mu held)
+func (s *Session) nickError(m ircMsg) {
+	bad := ""
+	if len(m.params) >= 2 {
+		bad = m.params[1]
+	}
+	s.mu.Lock()
+	if !s.registered {
+		s.nick = s.nextNick()
+		next := s.nick
+		s.addMsgTo(s.serverCh, s.fmtMsg(fgGrey+"Nick %s unavailable (%s), trying "+fgGreen+"%s"+rst, bad, m.trail(), next))
+		s.mu.Unlock()
+		s.ircSend("NICK " + next)
+		s.draw()
+		return
+	}
+	ac := s.activeChan()
+	ac.addMsg(s.fmtMsg(fgRed+bold+"✗ "+rst+fgRed+"Can't change nick to %s"+rst+": %s"+fgGrey+", you are still "+rst+"%s", bad, m.trail(), s.nick))
+	if m.command == "433" && s.account != "" {
+		ac.addMsg(s.fmtMsg(fgGrey+"If %s is registered to %s, take it back with "+fgGreen+"/regain %s"+fgGrey+" or "+fgGreen+"/ghost %s"+rst, bad, s.account, bad, bad))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// loggedIn tracks 900 RPL_LOGGEDIN / 901 RPL_LOGGEDOUT. (call without mu held)
+func (s *Session) loggedIn(m ircMsg) {
+	s.mu.Lock()
+	if m.command == "901" {
+		s.account = ""
+	} else if len(m.params) >= 3 {
+		s.account = m.params[2]
+		s.loadIgnores()
+	}
+	s.mu.Unlock()
+}
+
+// cmdRecover implements /ghost and /regain. GHOST only disconnects the
+// other session, so the nick change follows a moment later.
+func (s *Session) cmdRecover(cmd, arg string) {
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	acct := s.account
+	s.mu.Unlock()
+	if len(f) == 0 {
+		s.opNote("Usage: %s <nick>", cmd)
+		return
+	}
+	if acct == "" {
+		s.opNote("Identify to NickServ first, %s only works for nicks your account owns", cmd)
+		return
+	}
+	nick := f[0]
+	if cmd == "/regain" {
+		s.ircSend("PRIVMSG NickServ :REGAIN " + nick)
+		return
+	}
+	s.ircSend("PRIVMSG NickServ :GHOST " + nick)
+	time.AfterFunc(2*time.Second, func() {
+		s.mu.Lock()
+		have := strings.EqualFold(s.nick, nick)
+		s.mu.Unlock()
+		if !have && s.alive {
+			s.ircSend("NICK " + nick)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// ── Highlight window and notifications ──
+// Every mention and PM is copied into *highlights with its source window
+// and line, optionally rings the terminal (/set notify), and /hl N jumps
+// back to it.
+
+const hlWin = "*highlights"
+
+var notifyModes = []string{"off", "bell", "osc9", "osc777"}
+
+type hlRef struct {
+	ch   string // source window
+	line int    // stable line id in it
+}
+
+// noteHighlight records the line just added to c. (call with mu held)
+func (s *Session) noteHighlight(c *Channel, sender, text string) {
+	s.hls = append(s.hls, hlRef{c.name, c.lineID()})
+	if drop := len(s.hls) - maxMsgs; drop > 0 {
+		s.hls = s.hls[drop:]
+		s.hlBase += drop
+	}
+	w := s.getOrMakeChan(hlWin)
+	s.addChatTo(w, s.fmtMsg(fgGrey+"%3d "+rst+fgCyan+"%-14s"+rst+" "+nickColor(sender)+"<%s>"+rst+" %s",
+		s.hlBase+len(s.hls), c.name, sender, text))
+	if c != s.activeChan() && w != s.activeChan() {
+		w.highlight++
+	}
+	s.alerts += s.notifySeq(c.name, sender, text)
+}
+
+// notifySeq builds the terminal notification for a highlight, or "".
+// (call with mu held)
+func (s *Session) notifySeq(ch, sender, text string) string {
+	clean := func(str string) string {
+		var b strings.Builder
+		for _, r := range str {
+			if r < 0x20 || r == 0x7f || r >= 0x80 && r < 0xa0 {
+				continue
+			}
+			encodeRune(&b, s.charset, r)
+		}
+		return b.String()
+	}
+	title := sender
+	if ch != sender {
+		title = sender + " in " + ch
+	}
+	switch s.notify {
+	case "bell":
+		return "\a"
+	case "osc9":
+		return "\033]9;" + clean(title+": "+text) + "\a"
+	case "osc777":
+		return "\033]777;notify;" + clean(strings.ReplaceAll(title, ";", ",")) + ";" + clean(text) + "\a"
+	}
+	return ""
+}
+
+func notifySet(s *Session, v string) error {
+	for _, m := range notifyModes {
+		if v == m {
+			s.notify = v
+			return nil
+		}
+	}
+	return errors.New("expected one of " + strings.Join(notifyModes, ", "))
+}
+
+// cmdHL jumps to highlight N, the latest by default.
+func (s *Session) cmdHL(arg string) {
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.draw()
+	}()
+	ac := s.activeChan()
+	if len(s.hls) == 0 {
+		ac.addMsg(s.fmtMsg(fgGrey + "No highlights yet" + rst))
+		return
+	}
+	n := s.hlBase + len(s.hls)
+	if arg = strings.TrimSpace(arg); arg != "" {
+		n = simpleAtoi(arg)
+	}
+	i := n - 1 - s.hlBase
+	if i < 0 || i >= len(s.hls) {
+		ac.addMsg(s.fmtMsg(fgGrey+"No highlight %s (%d-%d)"+rst, arg, s.hlBase+1, s.hlBase+len(s.hls)))
+		return
+	}
+	ref := s.hls[i]
+	c := s.getChan(ref.ch)
+	if c == nil {
+		ac.addMsg(s.fmtMsg(fgGrey+"%s is closed"+rst, ref.ch))
+		return
+	}
+	s.switchTo(c.name)
+	if !s.scrollToLine(c, ref.line) {
+		c.addMsg(s.fmtMsg(fgGrey + "That line has scrolled out of the buffer" + rst))
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ── Channel operator commands ──
+// /op /deop /voice /devoice /ban /unban /kick /kickban /mode /invite.
+// Mode changes with several targets are batched per the server's MODES.
+
+var maskStyles = []string{"host", "userhost", "nick", "domain", "full"}
+
+// banMaskFor turns a nick into a ban mask in the configured style using the
+// cached user@host. Masks are passed through. (call with mu held)
+func (s *Session) banMaskFor(target string) string {
+	if strings.ContainsAny(target, "!@*") {
+		return target
+	}
+	u := s.user(target)
+	if u == nil {
+		return target + "!*@*"
+	}
+	switch s.banMask {
+	case "userhost":
+		return "*!*" + strings.TrimPrefix(u.user, "~") + "@" + u.host
+	case "nick":
+		return u.nick + "!*@*"
+	case "domain":
+		return "*!*@" + wildHost(u.host)
+	case "full":
+		return u.nick + "!" + u.user + "@" + u.host
+	}
+	return "*!*@" + u.host
+}
+
+// wildHost widens a host to its network: the last octet of an IPv4 address
+// or the first label of a hostname.
+func wildHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return fmt.Sprintf("%d.%d.%d.*", v4[0], v4[1], v4[2])
+		}
+		return host
+	}
+	if i := strings.IndexByte(host, '.'); i >= 0 && strings.Count(host, ".") >= 2 {
+		return "*" + host[i:]
+	}
+	return host
+}
+
+// sendModes sets or unsets mode for every arg, as few MODE lines as the
+// server allows.
+func (s *Session) sendModes(ch, sign string, mode byte, args []string) {
+	s.mu.Lock()
+	per := 3 // RFC default when MODES isn't advertised
+	if v, ok := s.support("MODES"); ok {
+		if v == "" {
+			per = len(args) // no limit
+		} else if n := simpleAtoi(v); n > 0 {
+			per = n
+		}
+	}
+	s.mu.Unlock()
+	for len(args) > 0 {
+		n := min(per, len(args))
+		s.ircSend(fmt.Sprintf("MODE %s %s%s %s", ch, sign, strings.Repeat(string(mode), n), strings.Join(args[:n], " ")))
+		args = args[n:]
+	}
+}
+
+// opNote prints a usage or error line in the active window.
+func (s *Session) opNote(format string, args ...interface{}) {
+	s.mu.Lock()
+	s.activeChan().addMsg(s.fmtMsg(fgGrey+format+rst, args...))
+	s.mu.Unlock()
+	s.draw()
+}
+
+func (s *Session) cmdOp(cmd, arg string) {
+	arg = strings.TrimSpace(arg)
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	ch := s.activeChan().name
+	s.mu.Unlock()
+
+	// /mode and /invite can name the channel, everything else acts on the
+	// active one
+	if cmd == "/mode" {
+		if len(f) > 0 && f[0][0] != '+' && f[0][0] != '-' {
+			ch, f = f[0], f[1:]
+		} else if !strings.HasPrefix(ch, "#") {
+			s.mu.Lock()
+			ch = s.nick // user modes outside a channel
+			s.mu.Unlock()
+		}
+		if len(f) == 0 {
+			s.ircSend("MODE " + ch)
+		} else {
+			s.ircSend("MODE " + ch + " " + strings.Join(f, " "))
+		}
+		return
+	}
+	if cmd == "/invite" {
+		if len(f) == 0 {
+			s.opNote("Usage: /invite <nick> [#channel]")
+			return
+		}
+		if len(f) > 1 {
+			ch = f[1]
+		}
+		if !strings.HasPrefix(ch, "#") {
+			s.opNote("Not in a channel")
+			return
+		}
+		s.ircSend(fmt.Sprintf("INVITE %s %s", f[0], ch))
+		s.opNote("Invited %s to %s", f[0], ch)
+		return
+	}
+
+	if !strings.HasPrefix(ch, "#") {
+		s.opNote("%s only works in a channel", cmd)
+		return
+	}
+	if len(f) == 0 {
+		s.opNote("Usage: %s <nick> [nick...]", cmd)
+		return
+	}
+
+	switch cmd {
+	case "/op":
+		s.sendModes(ch, "+", 'o', f)
+	case "/deop":
+		s.sendModes(ch, "-", 'o', f)
+	case "/voice":
+		s.sendModes(ch, "+", 'v', f)
+	case "/devoice":
+		s.sendModes(ch, "-", 'v', f)
+	case "/ban":
+		s.mu.Lock()
+		masks := make([]string, len(f))
+		for i, n := range f {
+			masks[i] = s.banMaskFor(n)
+		}
+		s.mu.Unlock()
+		s.sendModes(ch, "+", 'b', masks)
+	case "/unban":
+		s.mu.Lock()
+		masks := make([]string, len(f))
+		for i, n := range f {
+			masks[i] = s.banMaskFor(n)
+		}
+		s.mu.Unlock()
+		s.sendModes(ch, "-", 'b', masks)
+	case "/kick":
+		reason := strings.TrimSpace(strings.TrimPrefix(arg, f[0]))
+		if reason == "" {
+			reason = f[0]
+		}
+		s.ircSend(fmt.Sprintf("KICK %s %s :%s", ch, f[0], reason))
+	case "/kickban", "/kb":
+		reason := strings.TrimSpace(strings.TrimPrefix(arg, f[0]))
+		if reason == "" {
+			reason = f[0]
+		}
+		s.mu.Lock()
+		mask := s.banMaskFor(f[0])
+		s.mu.Unlock()
+		s.sendModes(ch, "+", 'b', []string{mask})
+		s.ircSend(fmt.Sprintf("KICK %s %s :%s", ch, f[0], reason))
+	}
+}
+
+// chanOpNeeded reports 482 ERR_CHANOPRIVSNEEDED in the channel it's about.
+// (call without mu held)
+func (s *Session) chanOpNeeded(m ircMsg) {
+	if len(m.params) < 2 {
+		return
+	}
+	s.mu.Lock()
+	c := s.getChan(m.params[1])
+	if c == nil {
+		c = s.activeChan()
+	}
+	s.addMsgTo(c, s.fmtMsg(fgRed+bold+"✗ "+rst+fgRed+"You need channel operator status in %s for that"+rst+fgGrey+" (%s)"+rst, m.params[1], m.trail()))
+	s.mu.Unlock()
+	s.draw()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ── Paste detection ──
+// nc and telnet deliver a pasted block as separate lines a few ms apart.
+// Lines arriving that close together are held and the user is asked before
+// anything is sent, instead of flooding the channel one PRIVMSG per line.
+
+const (
+	pasteWindow = 75 * time.Millisecond // nobody types two Enters this fast
+	pasteMin    = 4                     // lines in a burst before asking
+)
+
+// burst returns any further lines that arrive within pasteWindow of the
+// previous one. A paste shows up as more input right behind the line just
+// read; without any, typed lines go through at once.
+func (r *clientReader) burst() []string {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	var lines []string
+	for {
+		r.extractCPR()
+		if i := strings.IndexByte(string(r.buf), '\n'); i >= 0 {
+			line := strings.TrimRight(string(r.buf[:i]), "\r")
+			r.buf = r.buf[i+1:]
+			lines = append(lines, strings.TrimSpace(line))
+			continue
+		}
+		r.conn.SetReadDeadline(time.Now().Add(pasteWindow))
+		n, err := r.conn.Read(r.tmp[:])
+		if n > 0 {
+			r.ingest(r.tmp[:n])
+		}
+		if err != nil {
+			r.conn.SetReadDeadline(time.Now().Add(300 * time.Second))
+			return lines
+		}
+	}
+}
+
+// holdPaste stores lines for confirmation. (call without mu held)
+func (s *Session) holdPaste(lines []string) {
+	s.mu.Lock()
+	s.paste = lines
+	s.pasteTo = s.activeChan().name
+	s.mu.Unlock()
+	s.draw()
+}
+
+// answerPaste sends or drops the held paste depending on the reply. Pasted
+// lines go to pasteTo as plain text, never as commands.
+// (call without mu held)
+func (s *Session) answerPaste(reply string) {
+	s.mu.Lock()
+	lines := s.paste
+	s.paste = nil
+	ch := s.getChan(s.pasteTo)
+	s.mu.Unlock()
+
+	switch strings.ToLower(strings.TrimSpace(reply)) {
+	case "y", "yes":
+		if ch == nil || strings.HasPrefix(ch.name, "*") {
+			s.mu.Lock()
+			s.activeChan().addMsg(s.fmtMsg(fgGrey+"Cannot send a paste to %s"+rst, s.pasteTo))
+			s.mu.Unlock()
+			s.draw()
+			return
+		}
+		for _, l := range lines {
+			if l != "" {
+				s.say(ch, ch.name, l, false)
+			}
+		}
+		s.draw()
+	default:
+		s.mu.Lock()
+		s.activeChan().addMsg(s.fmtMsg(fgGrey+"Paste of %d lines discarded"+rst, len(lines)))
+		s.mu.Unlock()
+		s.draw()
+	}
+}
+
+// pastePrompt is the input line text while a paste waits. (call with mu held)
+func (s *Session) pastePrompt() string {
+	return fmt.Sprintf("Send %d lines to %s? [y/N] ", len(s.paste), s.pasteTo)
+}
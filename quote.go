@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// ── Raw protocol access ──
+// /quote sends a line as-is (subject to -quote-allow / -quote-deny) and the
+// *raw window logs every line in both directions.
+
+const rawWin = "*raw"
+
+var (
+	quoteAllow = flag.String("quote-allow", "", "comma-separated commands /quote may send (empty = any)")
+	quoteDeny  = flag.String("quote-deny", "", "comma-separated commands /quote may never send")
+)
+
+func inList(list, cmd string) bool {
+	for _, c := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(c), cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteCommand drops a leading :prefix from line, which clients have no use
+// for, and returns the line and its uppercased command.
+func quoteCommand(line string) (string, string) {
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+		line = strings.TrimLeft(line, " ")
+	}
+	cmd, _, _ := strings.Cut(line, " ")
+	return line, strings.ToUpper(cmd)
+}
+
+// quoteAllowed checks cmd against the operator's lists.
+func quoteAllowed(cmd string) bool {
+	if *quoteAllow != "" && !inList(*quoteAllow, cmd) {
+		return false
+	}
+	return !inList(*quoteDeny, cmd)
+}
+
+func (s *Session) cmdQuote(arg string) {
+	line, cmd := quoteCommand(strings.TrimSpace(arg))
+	if cmd == "" {
+		s.opNote("Usage: /quote <raw IRC line>")
+		return
+	}
+	if strings.ContainsAny(line, "\r\n") || !quoteAllowed(cmd) {
+		s.opNote("%s is not allowed on this server", cmd)
+		return
+	}
+	s.ircSend(line)
+}
+
+// toggleRaw opens or closes the *raw window.
+func (s *Session) toggleRaw() {
+	s.mu.Lock()
+	s.rawLog = !s.rawLog
+	if s.rawLog {
+		s.getOrMakeChan(rawWin).addMsg(s.fmtMsg(fgGrey + "Logging raw IRC traffic " + fgGreen + "«" + fgGrey + " in, " + fgRed + "»" + fgGrey + " out │ /raw to stop" + rst))
+		s.switchTo(rawWin)
+	} else {
+		s.removeChan(rawWin)
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// logRaw adds one protocol line to *raw when it's open. (call without mu held)
+func (s *Session) logRaw(line string, out bool) {
+	s.mu.Lock()
+	if s.rawLog {
+		if c := s.getChan(rawWin); c != nil {
+			mark := fgGreen + "«" + rst
+			if out {
+				mark = fgRed + "»" + rst
+			}
+			s.addMsgTo(c, s.fmtMsg(mark+" %s", strings.ReplaceAll(line, "\033", "^[")))
+		}
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ── Screen buffer ──
+// draw() paints into a frame of cells; flush() compares it with the last
+// frame sent to the client and emits only the cells that changed.
+
+const (
+	staleCh = -1 // never matches a painted cell, forces a rewrite
+	wideCh  = -2 // right half of the double-width rune in the cell before
+)
+
+// East Asian Wide and Fullwidth ranges, plus the emoji blocks terminals
+// draw two columns wide.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x2E80, 0x303E}, {0x3041, 0x33FF}, {0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F300, 0x1F64F},
+	{0x1F680, 0x1F6FF}, {0x1F900, 0x1F9FF}, {0x20000, 0x3FFFD},
+}
+
+// runeWidth is the number of columns ch takes: 0 for control codes and
+// combining marks, 2 for wide runes, else 1.
+func runeWidth(ch rune) int {
+	if ch < 0x20 || ch >= 0x7f && ch < 0xa0 || unicode.In(ch, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, r := range wideRanges {
+		if ch >= r[0] && ch <= r[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// mircColorLen is the length of the digits after a mIRC \x03 color code:
+// up to two, then optionally a comma and up to two more.
+func mircColorLen(s string) int {
+	digits := func(i int) int {
+		n := 0
+		for n < 2 && i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+			n++
+		}
+		return n
+	}
+	n := digits(0)
+	if n > 0 && n < len(s) && s[n] == ',' {
+		if bg := digits(n + 1); bg > 0 {
+			n += 1 + bg
+		}
+	}
+	return n
+}
+
+type cell struct {
+	ch    rune
+	style string // accumulated SGR sequences since the last reset
+}
+
+type frame struct {
+	w, h  int
+	cells []cell
+	th    *Theme  // resolves role codes in painted text, nil = literal
+	cs    charset // encoding of the client terminal
+}
+
+func newFrame(w, h int) *frame {
+	f := &frame{w: w, h: h, cells: make([]cell, w*h)}
+	for i := range f.cells {
+		f.cells[i].ch = ' '
+	}
+	return f
+}
+
+func (f *frame) row(r int) []cell {
+	return f.cells[(r-1)*f.w : r*f.w]
+}
+
+// fill paints n blank cells with the given style starting at (r, c).
+func (f *frame) fill(r, c, n int, style string) {
+	if r < 1 || r > f.h {
+		return
+	}
+	row := f.row(r)
+	for i := c - 1; i < c-1+n && i < f.w; i++ {
+		if i >= 0 {
+			row[i] = cell{' ', style}
+		}
+	}
+}
+
+// put paints s at (r, c) starting in the given style, honouring SGR escapes
+// embedded in s and clipping to maxW cells. mIRC formatting and other
+// control codes are dropped and wide runes take two cells, so the frame
+// matches what the terminal shows. Returns the number of cells used.
+func (f *frame) put(r, c int, style, s string, maxW int) int {
+	if r < 1 || r > f.h || c < 1 {
+		return 0
+	}
+	row := f.row(r)
+	vis := 0
+	inEsc := false
+	var esc strings.Builder
+	for i := 0; i < len(s); {
+		ch, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if ch == '\x03' && !inEsc {
+			i += mircColorLen(s[i:])
+			continue
+		}
+		if ch == '\033' {
+			inEsc = true
+			esc.Reset()
+			esc.WriteRune(ch)
+			continue
+		}
+		if inEsc {
+			esc.WriteRune(ch)
+			if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') {
+				inEsc = false
+				if ch == 'm' {
+					seq := esc.String()
+					if seq == rst || seq == "\033[m" {
+						style = ""
+					} else if f.th != nil {
+						style += f.th.resolve(seq)
+					} else {
+						style += seq
+					}
+				}
+			}
+			continue
+		}
+		w := runeWidth(ch)
+		if w == 0 {
+			continue
+		}
+		if vis+w > maxW || c-1+vis+w > f.w {
+			break
+		}
+		row[c-1+vis] = cell{ch, style}
+		if w == 2 {
+			row[c+vis] = cell{wideCh, style}
+		}
+		vis += w
+	}
+	return vis
+}
+
+// tail returns the index just past the last cell in row r that isn't a
+// default blank.
+func (f *frame) tail(r int) int {
+	row := f.row(r)
+	for i := len(row) - 1; i >= 0; i-- {
+		if row[i] != (cell{' ', ""}) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (f *frame) rowEqual(o *frame, r int) bool {
+	a, b := f.row(r), o.row(r)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diff writes the escape sequences that turn prev into f.
+func (f *frame) diff(prev *frame, out *strings.Builder) {
+	cur := "\x00" // terminal style unknown
+	for r := 1; r <= f.h; r++ {
+		row, old := f.row(r), prev.row(r)
+		tail := f.tail(r)
+		c := 0
+		for c < f.w {
+			if row[c] == old[c] {
+				c++
+				continue
+			}
+			if row[c].ch == wideCh && c > 0 {
+				c-- // repaint the whole wide rune
+			}
+			out.WriteString(pos(r, c+1))
+			for c < f.w {
+				if c >= tail {
+					// Rest of the row is blank, erase instead of painting spaces
+					if cur != "" {
+						out.WriteString(rst)
+						cur = ""
+					}
+					out.WriteString(clrEOL)
+					c = f.w
+					break
+				}
+				if row[c] == old[c] {
+					// Short unchanged gaps are cheaper to repaint than to jump over
+					n := 0
+					for c+n < f.w && n <= 4 && row[c+n] == old[c+n] {
+						n++
+					}
+					if n > 4 || c+n >= f.w {
+						c += n
+						break
+					}
+				}
+				if row[c].style != cur {
+					out.WriteString(rst + row[c].style)
+					cur = row[c].style
+				}
+				switch {
+				case row[c].ch == wideCh:
+					// Drawn along with the rune before it
+				case c+1 < f.w && row[c+1].ch == wideCh:
+					// Put the cursor where we expect it whatever width the
+					// terminal gave the rune
+					encodeRune(out, f.cs, row[c].ch)
+					out.WriteString(pos(r, c+3))
+				default:
+					encodeRune(out, f.cs, row[c].ch)
+				}
+				c++
+			}
+		}
+	}
+	if cur != "" && cur != "\x00" {
+		out.WriteString(rst)
+	}
+}
+
+// flush sends fr to the client as a diff against the previous frame and
+// leaves the cursor on the input line. alerts (bell, OSC notifications)
+// follow the frame.
+func (s *Session) flush(fr *frame, curRow, curCol int, alerts string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	prev := s.scr
+	full := prev == nil || prev.w != fr.w || prev.h != fr.h
+	var b strings.Builder
+	if full {
+		b.Grow(16384)
+		b.WriteString("\033[r")   // Reset scroll region for full-screen drawing
+		b.WriteString("\033[?7l") // Disable autowrap (prevents input wrapping to next line)
+		b.WriteString(hideCur + clrScr)
+		prev = newFrame(fr.w, fr.h)
+	}
+
+	// Leave the cursor where the user is typing unless the input line changed
+	inputDirty := !fr.rowEqual(prev, curRow)
+	var d strings.Builder
+	fr.diff(prev, &d)
+	s.scr = fr
+	if !full && d.Len() == 0 && alerts == "" {
+		return
+	}
+	if !full {
+		b.WriteString(hideCur)
+		if !inputDirty {
+			b.WriteString("\033[s")
+		}
+	}
+	b.WriteString(d.String())
+
+	// Set scroll region to rows 1..H-1 so Enter on row H can't scroll the layout
+	if full && fr.h > 2 {
+		b.WriteString(fmt.Sprintf("\033[1;%dr", fr.h-1))
+	}
+	if inputDirty {
+		b.WriteString(pos(curRow, curCol))
+	} else {
+		b.WriteString("\033[u")
+	}
+	b.WriteString(showCur)
+	b.WriteString(alerts)
+
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	s.conn.Write([]byte(b.String()))
+}
+
+// invalidate forces the next draw to clear and repaint the whole screen.
+func (s *Session) invalidate() {
+	s.writeMu.Lock()
+	s.scr = nil
+	s.writeMu.Unlock()
+}
+
+// staleRow marks row r as overwritten outside the renderer so the next draw
+// repaints it.
+func (s *Session) staleRow(r int) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.scr == nil || r < 1 || r > s.scr.h {
+		return
+	}
+	row := s.scr.row(r)
+	for i := range row {
+		row[i] = cell{staleCh, ""}
+	}
+}
+
+// ── Render loop ──
+// IRC and input handlers only mark the screen dirty, so a burst of events
+// (e.g. a netsplit) costs one frame and a slow client can't stall the IRC
+// reader on its write deadline.
+
+const maxFPS = 20
+
+func (s *Session) draw() {
+	select {
+	case s.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) renderLoop(quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-s.dirty:
+		}
+		s.render()
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Second / maxFPS):
+		}
+	}
+}
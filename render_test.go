@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countConn discards what the renderer writes and counts the bytes.
+type countConn struct {
+	net.Conn
+	n int
+}
+
+func (c *countConn) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func (c *countConn) SetWriteDeadline(time.Time) error { return nil }
+
+// chatSession builds an 80x24 session showing a busy channel.
+func chatSession() (*Session, *countConn) {
+	cc := &countConn{}
+	s := newSession(cc)
+	s.w, s.h = 80, 24
+	s.charset = csUTF8
+	c := s.getOrMakeChan("#go-nuts")
+	c.topic = "Go programming | https://go.dev | be nice"
+	for i := 0; i < 40; i++ {
+		n := fmt.Sprintf("gopher%d", i)
+		c.nicks[n] = n
+	}
+	for i := 0; i < 200; i++ {
+		n := fmt.Sprintf("gopher%d", i%40)
+		c.addMsg(s.fmtMsg(nickColor(n)+"<%s>"+rst+" line %d of a typical conversation about channels and goroutines", n, i))
+	}
+	s.switchTo(c.name)
+	return s, cc
+}
+
+func BenchmarkRender(b *testing.B) {
+	s, cc := chatSession()
+	s.render()
+
+	var full, diff int
+	for i := 0; i < b.N; i++ {
+		s.invalidate()
+		cc.n = 0
+		s.render()
+		full = cc.n
+
+		s.mu.Lock()
+		s.activeChan().addMsg(s.fmtMsg(nickColor("gopher1")+"<gopher1>"+rst+" one more line %d", i))
+		s.mu.Unlock()
+		cc.n = 0
+		s.render()
+		diff = cc.n
+	}
+	b.ReportMetric(float64(full), "full-B")
+	b.ReportMetric(float64(diff), "line-B")
+}
+
+func TestFramePut(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		vis            int
+	}{
+		{"plain", "abc", "abc", 3},
+		{"mIRC codes", "\x02b\x0f \x0304red\x03 \x0304,12x\x031,2y\x1dz\x1f\x16", "b red xyz", 9},
+		{"color then digits", "\x03041999", "1999", 4},
+		{"bell and tab", "a\a\tb", "ab", 2},
+		{"wide", "a漢b", "a漢_b", 4},
+		{"emoji", "🎉!", "🎉_!", 3},
+		{"combining", "éx", "ex", 2},
+		{"wide clipped", "abcdefghi漢", "abcdefghi", 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFrame(10, 1)
+			vis := f.put(1, 1, "", tt.in, 10)
+			var got strings.Builder
+			for _, c := range f.row(1)[:vis] {
+				if c.ch == wideCh {
+					got.WriteByte('_')
+				} else {
+					got.WriteRune(c.ch)
+				}
+			}
+			if got.String() != tt.want || vis != tt.vis {
+				t.Errorf("put(%q) = %q (%d cells), want %q (%d)", tt.in, got.String(), vis, tt.want, tt.vis)
+			}
+		})
+	}
+}
+
+func TestFrameDiffWide(t *testing.T) {
+	prev, next := newFrame(6, 1), newFrame(6, 1)
+	prev.put(1, 1, "", "a漢b", 6)
+	next.put(1, 1, "", "a漢c", 6)
+	var out strings.Builder
+	next.diff(prev, &out)
+	if got := out.String(); got != pos(1, 4)+rst+"c"+clrEOL {
+		t.Errorf("changed narrow cell: %q", got)
+	}
+
+	// Only the right half differs: the wide rune is repainted from its
+	// first column and the cursor placed explicitly after it
+	prev, next = newFrame(6, 1), newFrame(6, 1)
+	prev.put(1, 1, "", "ab漢", 6)
+	next.put(1, 1, "", "a字", 6)
+	out.Reset()
+	next.diff(prev, &out)
+	if got, want := out.String(), pos(1, 2)+rst+"字"+pos(1, 4)+clrEOL; got != want {
+		t.Errorf("shifted wide rune: %q, want %q", got, want)
+	}
+}
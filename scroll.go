@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// ── Scrollback ──
+// /hl scrolls a window back to the line it points at; new lines keep a
+// scrolled view in place and an empty Enter returns to the bottom. Line
+// numbers stay stable as old lines are trimmed, so other windows
+// (e.g. *highlights) can point back at one.
+
+// lineID returns the stable number of c's last line. (call with mu held)
+func (c *Channel) lineID() int {
+	return c.base + len(c.msgs) - 1
+}
+
+// maxScroll is how far c can scroll up with mH chat rows. (call with mu held)
+func (s *Session) maxScroll(c *Channel, mH int) int {
+	return max(s.visibleCount(c)-mH, 0)
+}
+
+// scrollToLine centers line id in the view; reports false if it has been
+// trimmed. (call with mu held)
+func (s *Session) scrollToLine(c *Channel, id int) bool {
+	idx := id - c.base
+	if idx < 0 || idx >= len(c.msgs) {
+		return false
+	}
+	below := 0 // visible lines after it
+	hide := s.smartOn(c)
+	for _, m := range c.msgs[idx+1:] {
+		if !hide || !strings.HasPrefix(m, roleHidden) {
+			below++
+		}
+	}
+	mH := s.mainH()
+	c.scroll = min(max(below-mH/2, 0), s.maxScroll(c, mH))
+	return true
+}
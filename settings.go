@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ── Settings ──
+// Per-session options changed with /set <name> <value>.
+
+type setting struct {
+	name, help string
+	get        func(s *Session) string
+	set        func(s *Session, v string) error
+}
+
+var settings = []setting{
+	{
+		name: "banmask", help: "ban mask style: " + strings.Join(maskStyles, ", "),
+		get: func(s *Session) string { return s.banMask },
+		set: func(s *Session, v string) error {
+			for _, st := range maskStyles {
+				if v == st {
+					s.banMask = v
+					return nil
+				}
+			}
+			return errors.New("expected one of " + strings.Join(maskStyles, ", "))
+		},
+	},
+	{
+		name: "altnicks", help: "comma-separated nicks to try when yours is taken",
+		get: func(s *Session) string { return strings.Join(s.altNicks, ",") },
+		set: func(s *Session, v string) error {
+			s.altNicks = nil
+			for _, n := range strings.Split(v, ",") {
+				if n = strings.TrimSpace(n); n != "" && n != "-" {
+					s.altNicks = append(s.altNicks, n)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "autoaway", help: "minutes without input before marking you away (0 = off)",
+		get: func(s *Session) string { return strconv.Itoa(s.autoAwayMins) },
+		set: autoAwaySet,
+	},
+	{
+		name: "hlwords", help: "comma-separated extra highlight words, /regex/ for patterns",
+		get: func(s *Session) string { return patternsString(s.hlWords) },
+		set: func(s *Session, v string) error {
+			ps, err := s.parsePatterns(v)
+			if err == nil {
+				s.hlWords = ps
+			}
+			return err
+		},
+	},
+	{
+		name: "hlexclude", help: "words or /regex/ that stop a line from highlighting",
+		get: func(s *Session) string { return patternsString(s.hlExclude) },
+		set: func(s *Session, v string) error {
+			ps, err := s.parsePatterns(v)
+			if err == nil {
+				s.hlExclude = ps
+			}
+			return err
+		},
+	},
+	{
+		name: "notify", help: "terminal alert on highlights: " + strings.Join(notifyModes, ", "),
+		get: func(s *Session) string { return s.notify },
+		set: notifySet,
+	},
+	{
+		name: "smartfilter", help: "hide join/part/quit/nick of users who haven't spoken lately (on/off)",
+		get: func(s *Session) string { return onOff(s.smart) },
+		set: func(s *Session, v string) error {
+			b, err := parseOnOff(v)
+			if err == nil {
+				s.smart = b
+			}
+			return err
+		},
+	},
+	{
+		name: "smartdelay", help: "minutes since speaking that keep a user's joins/parts visible",
+		get: func(s *Session) string { return strconv.Itoa(s.smartMins) },
+		set: smartDelaySet,
+	},
+	{
+		name: "collapse", help: "merge consecutive joins/parts/quits into one line (on/off)",
+		get: func(s *Session) string { return onOff(s.collapse) },
+		set: func(s *Session, v string) error {
+			b, err := parseOnOff(v)
+			if err == nil {
+				s.collapse = b
+			}
+			return err
+		},
+	},
+	{
+		name: "rejoin", help: "seconds to wait before rejoining after a kick, or off",
+		get: rejoinGet, set: rejoinSet,
+	},
+	{
+		name: "rejoinmax", help: "kicks in a row before auto-rejoin gives up (0 = never)",
+		get: func(s *Session) string { return strconv.Itoa(s.rejoinMax) },
+		set: func(s *Session, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return errors.New("expected a number")
+			}
+			s.rejoinMax = n
+			return nil
+		},
+	},
+}
+
+// cmdSet lists the settings or changes one. (call without mu held)
+func (s *Session) cmdSet(arg string) {
+	f := strings.Fields(arg)
+	s.mu.Lock()
+	ac := s.activeChan()
+	switch {
+	case len(f) == 0:
+		ac.addMsg(s.fmtMsg(fgCyan + bold + "── Settings ──" + rst))
+		for _, st := range settings {
+			ac.addMsg(s.fmtMsg(fgGreen+" %-10s"+rst+" %-12s "+fgGrey+"%s"+rst, st.name, st.get(s), st.help))
+		}
+	default:
+		var st *setting
+		for i := range settings {
+			if settings[i].name == strings.ToLower(f[0]) {
+				st = &settings[i]
+			}
+		}
+		if st == nil {
+			ac.addMsg(s.fmtMsg(fgGrey+"Unknown setting "+fgWhite+"%s"+fgGrey+". Type /set to list"+rst, f[0]))
+		} else if len(f) == 1 {
+			ac.addMsg(s.fmtMsg(fgGreen+"%s"+rst+" = %s "+fgGrey+"(%s)"+rst, st.name, st.get(s), st.help))
+		} else if err := st.set(s, strings.Join(f[1:], " ")); err != nil {
+			ac.addMsg(s.fmtMsg(fgRed+"%s: "+rst+"%s", st.name, err))
+		} else {
+			ac.addMsg(s.fmtMsg(fgGreen+"%s"+rst+" = %s", st.name, st.get(s)))
+		}
+	}
+	s.mu.Unlock()
+	s.draw()
+}
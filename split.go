@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ── Long message splitting ──
+// The server relays our PRIVMSG to others as
+//   :nick!user@host PRIVMSG target :text\r\n
+// which must fit in 512 bytes, so we split on our side where we can still
+// pick UTF-8 and word boundaries and echo exactly what was sent.
+
+const (
+	ircLineMax = 512
+	// Assumed until the server tells us our hostmask (USERLEN + HOSTLEN)
+	guessUserHost = len("~tunnel@") + 63
+)
+
+// maxPayload returns how many bytes of text fit in one PRIVMSG to target,
+// with extra bytes reserved for CTCP framing. (call with mu held)
+func (s *Session) maxPayload(target string, extra int) int {
+	uh := len(s.userhost)
+	if uh == 0 {
+		uh = guessUserHost
+	}
+	// ":" nick "!" userhost " PRIVMSG " target " :" text "\r\n"
+	n := ircLineMax - (1 + len(s.nick) + 1 + uh + len(" PRIVMSG ") + len(target) + len(" :") + 2) - extra
+	if n < 32 {
+		n = 32
+	}
+	return n
+}
+
+// splitMsg cuts text into pieces of at most limit bytes, preferring to break
+// at a space in the second half of a piece and never inside a UTF-8 rune.
+func splitMsg(text string, limit int) []string {
+	var parts []string
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if sp := strings.LastIndexByte(text[:cut], ' '); sp > cut/2 {
+			cut = sp
+		}
+		if cut == 0 {
+			cut = limit // no rune start found, give up on boundaries
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimPrefix(text[cut:], " ")
+	}
+	if text != "" || len(parts) == 0 {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// say sends text (or a /me action) to target in as many lines as needed
+// and echoes each one into ch. (call without mu held)
+func (s *Session) say(ch *Channel, target, text string, action bool) {
+	s.mu.Lock()
+	extra := 0
+	if action {
+		extra = len("\x01ACTION \x01")
+	}
+	parts := splitMsg(text, s.maxPayload(target, extra))
+	nick := s.nick
+	s.mu.Unlock()
+
+	for _, p := range parts {
+		if action {
+			s.ircSend(fmt.Sprintf("PRIVMSG %s :\x01ACTION %s\x01", target, p))
+		} else {
+			s.ircSend(fmt.Sprintf("PRIVMSG %s :%s", target, p))
+		}
+	}
+
+	col := nickColor(nick)
+	s.mu.Lock()
+	for _, p := range parts {
+		if action {
+			ch.addMsg(s.fmtMsg(roleAction+"* %s %s"+rst, nick, p))
+		} else {
+			ch.addMsg(s.fmtMsg(col+"<%s>"+rst+" %s", nick, p))
+		}
+	}
+	s.mu.Unlock()
+}
+
+// setUserHost records our own user@host from a JOIN echo. (call with mu held)
+func (s *Session) setUserHost(prefix string) {
+	if i := strings.IndexByte(prefix, '!'); i >= 0 {
+		s.userhost = prefix[i+1:]
+	}
+}
+
+// setHiddenHost applies the host from 396 RPL_HOSTHIDDEN. (call with mu held)
+func (s *Session) setHiddenHost(host string) {
+	user := "~tunnel"
+	if i := strings.IndexByte(s.userhost, '@'); i >= 0 {
+		user = s.userhost[:i]
+	}
+	s.userhost = user + "@" + host
+}
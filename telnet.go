@@ -0,0 +1,258 @@
+package main
+
+// ── Telnet ──
+// A byte-at-a-time state machine, so commands split across reads are
+// buffered instead of leaking into the line buffer. Option negotiation
+// follows the Q method of RFC 1143 to avoid negotiation loops.
+
+const (
+	iacByte = 0xFF
+	iacSB   = 0xFA
+	iacSE   = 0xF0
+	iacWILL = 0xFB
+	iacWONT = 0xFC
+	iacDO   = 0xFD
+	iacDONT = 0xFE
+	optNAWS = 0x1F
+
+	maxSubneg = 1024 // longer subnegotiations are dropped
+)
+
+type telState int
+
+const (
+	tsData   telState = iota
+	tsIAC             // saw IAC
+	tsVerb            // saw IAC WILL/WONT/DO/DONT, option byte next
+	tsSB              // saw IAC SB, option byte next
+	tsSBData          // inside a subnegotiation
+	tsSBIAC           // saw IAC inside a subnegotiation
+)
+
+// RFC 1143 per-side option state
+type qState uint8
+
+const (
+	qNo qState = iota
+	qYes
+	qWantNo
+	qWantYes
+)
+
+type qOpt struct {
+	us, him   qState
+	usQ, himQ bool // OPPOSITE queued
+}
+
+type telnet struct {
+	state  telState
+	verb   byte
+	sbOpt  byte
+	sb     []byte
+	sbLost bool // subnegotiation overflowed maxSubneg
+	cr     bool // last data byte was CR
+	opts   [256]qOpt
+
+	himOK [256]bool // options we let the client enable
+	reply []byte    // negotiation bytes to send to the client
+
+	enabled func(opt byte)              // client agreed to opt
+	sub     func(opt byte, data []byte) // completed IAC SB opt ... IAC SE
+}
+
+// feed runs data through the state machine and returns the payload bytes.
+func (t *telnet) feed(data []byte, out []byte) []byte {
+	for _, b := range data {
+		switch t.state {
+		case tsData:
+			if b == iacByte {
+				t.state = tsIAC
+				continue
+			}
+			// CR NUL is a bare carriage return
+			if b == 0 && t.cr {
+				t.cr = false
+				continue
+			}
+			t.cr = b == '\r'
+			out = append(out, b)
+
+		case tsIAC:
+			switch b {
+			case iacByte:
+				out = append(out, iacByte)
+				t.cr = false
+				t.state = tsData
+			case iacWILL, iacWONT, iacDO, iacDONT:
+				t.verb = b
+				t.state = tsVerb
+			case iacSB:
+				t.state = tsSB
+			default: // NOP, GA, AYT, ... nothing to do in line mode
+				t.state = tsData
+			}
+
+		case tsVerb:
+			t.negotiate(t.verb, b)
+			t.state = tsData
+
+		case tsSB:
+			t.sbOpt = b
+			t.sb = t.sb[:0]
+			t.sbLost = false
+			t.state = tsSBData
+
+		case tsSBData:
+			if b == iacByte {
+				t.state = tsSBIAC
+				continue
+			}
+			t.sbByte(b)
+
+		case tsSBIAC:
+			switch b {
+			case iacSE:
+				if !t.sbLost && t.sub != nil {
+					t.sub(t.sbOpt, t.sb)
+				}
+				t.state = tsData
+			case iacByte:
+				t.sbByte(iacByte)
+				t.state = tsSBData
+			default:
+				// Protocol violation: abandon the subnegotiation and treat
+				// this as a command
+				t.feedIAC(b)
+			}
+		}
+	}
+	return out
+}
+
+func (t *telnet) feedIAC(b byte) {
+	switch b {
+	case iacWILL, iacWONT, iacDO, iacDONT:
+		t.verb = b
+		t.state = tsVerb
+	case iacSB:
+		t.state = tsSB
+	default:
+		t.state = tsData
+	}
+}
+
+func (t *telnet) sbByte(b byte) {
+	if len(t.sb) >= maxSubneg {
+		t.sbLost = true
+		return
+	}
+	t.sb = append(t.sb, b)
+}
+
+func (t *telnet) send(verb, opt byte) {
+	t.reply = append(t.reply, iacByte, verb, opt)
+}
+
+// enableHim asks the client to enable opt (we send DO).
+func (t *telnet) enableHim(opt byte) {
+	o := &t.opts[opt]
+	switch o.him {
+	case qNo:
+		o.him = qWantYes
+		t.send(iacDO, opt)
+	case qWantNo:
+		o.himQ = true
+	case qWantYes:
+		o.himQ = false
+	}
+}
+
+// negotiate answers WILL/WONT (client side) and DO/DONT (our side).
+func (t *telnet) negotiate(verb, opt byte) {
+	o := &t.opts[opt]
+	switch verb {
+	case iacWILL:
+		switch o.him {
+		case qNo:
+			if t.himOK[opt] {
+				o.him = qYes
+				t.send(iacDO, opt)
+				t.himEnabled(opt)
+			} else {
+				t.send(iacDONT, opt)
+			}
+		case qWantNo:
+			if o.himQ {
+				o.him, o.himQ = qYes, false
+				t.himEnabled(opt)
+			} else {
+				o.him = qNo // DONT answered by WILL
+			}
+		case qWantYes:
+			if o.himQ {
+				o.him, o.himQ = qWantNo, false
+				t.send(iacDONT, opt)
+			} else {
+				o.him = qYes
+				t.himEnabled(opt)
+			}
+		}
+
+	case iacWONT:
+		switch o.him {
+		case qYes:
+			o.him = qNo
+			t.send(iacDONT, opt)
+		case qWantNo:
+			if o.himQ {
+				o.him, o.himQ = qWantYes, false
+				t.send(iacDO, opt)
+			} else {
+				o.him = qNo
+			}
+		case qWantYes:
+			o.him, o.himQ = qNo, false
+		}
+
+	case iacDO:
+		switch o.us {
+		case qNo:
+			t.send(iacWONT, opt) // we don't offer any options of our own
+		case qWantNo:
+			if o.usQ {
+				o.us, o.usQ = qYes, false
+			} else {
+				o.us = qNo // WONT answered by DO
+			}
+		case qWantYes:
+			if o.usQ {
+				o.us, o.usQ = qWantNo, false
+				t.send(iacWONT, opt)
+			} else {
+				o.us = qYes
+			}
+		}
+
+	case iacDONT:
+		switch o.us {
+		case qYes:
+			o.us = qNo
+			t.send(iacWONT, opt)
+		case qWantNo:
+			if o.usQ {
+				o.us, o.usQ = qWantYes, false
+				t.send(iacWILL, opt)
+			} else {
+				o.us = qNo
+			}
+		case qWantYes:
+			o.us, o.usQ = qNo, false
+		}
+	}
+}
+
+func (t *telnet) himEnabled(opt byte) {
+	if t.enabled != nil {
+		t.enabled(opt)
+	}
+}
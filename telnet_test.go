@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// telRun feeds chunks through a fresh telnet and returns the payload, the
+// subnegotiations it reported as "opt:hex", and its negotiation replies.
+func telRun(chunks ...[]byte) (payload []byte, subs []string, reply []byte) {
+	t := &telnet{}
+	t.himOK[optNAWS] = true
+	t.sub = func(opt byte, data []byte) {
+		subs = append(subs, fmt.Sprintf("%d:%x", opt, data))
+	}
+	for _, c := range chunks {
+		payload = t.feed(c, payload)
+	}
+	return payload, subs, t.reply
+}
+
+// bytewise splits data into one-byte chunks.
+func bytewise(data []byte) [][]byte {
+	out := make([][]byte, len(data))
+	for i := range data {
+		out[i] = data[i : i+1]
+	}
+	return out
+}
+
+// escapeIAC doubles IAC bytes so data passes through as payload.
+func escapeIAC(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{iacByte}, []byte{iacByte, iacByte})
+}
+
+// stripCRNUL drops the NUL of each CR NUL pair, as feed does.
+func stripCRNUL(data []byte) []byte {
+	var out []byte
+	cr := false
+	for _, b := range data {
+		if b == 0 && cr {
+			cr = false
+			continue
+		}
+		cr = b == '\r'
+		out = append(out, b)
+	}
+	return out
+}
+
+func TestTelnetFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		payload string
+		subs    []string
+		reply   string
+	}{
+		{
+			name:    "NAWS split across reads",
+			chunks:  [][]byte{[]byte("ab"), {iacByte, iacSB}, {optNAWS, 0, 80}, {0, 24, iacByte}, {iacSE}, []byte("cd")},
+			payload: "abcd",
+			subs:    []string{"31:00500018"},
+		},
+		{
+			name:    "NAWS split after IAC",
+			chunks:  [][]byte{{iacByte}, {iacSB, optNAWS, 0, 100, 0, 40, iacByte}, {iacSE, 'x'}},
+			payload: "x",
+			subs:    []string{"31:00640028"},
+		},
+		{
+			name:    "WILL split",
+			chunks:  [][]byte{[]byte("a"), {iacByte}, {iacWILL}, {optNAWS}, []byte("b")},
+			payload: "ab",
+			reply:   string([]byte{iacByte, iacDO, optNAWS}),
+		},
+		{
+			name:    "escaped IAC",
+			chunks:  [][]byte{{'a', iacByte}, {iacByte, 'b'}},
+			payload: "a\xffb",
+		},
+		{
+			name:    "escaped IAC inside NAWS",
+			chunks:  [][]byte{{iacByte, iacSB, optNAWS, 0, iacByte}, {iacByte, 0, 24, iacByte, iacSE}},
+			payload: "",
+			subs:    []string{"31:00ff0018"},
+		},
+		{
+			name:    "CR NUL",
+			chunks:  [][]byte{{'a', '\r'}, {0, 'b'}},
+			payload: "a\rb",
+		},
+		{
+			name:    "escaped IAC after CR",
+			chunks:  [][]byte{{'\r', iacByte, iacByte, 0}},
+			payload: "\r\xff\x00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, subs, reply := telRun(tt.chunks...)
+			if string(payload) != tt.payload {
+				t.Errorf("payload = %q, want %q", payload, tt.payload)
+			}
+			if fmt.Sprint(subs) != fmt.Sprint(tt.subs) {
+				t.Errorf("subs = %v, want %v", subs, tt.subs)
+			}
+			if string(reply) != tt.reply {
+				t.Errorf("reply = %x, want %x", reply, tt.reply)
+			}
+		})
+	}
+}
+
+func FuzzTelnetFeed(f *testing.F) {
+	f.Add([]byte("hello\r\n"), uint8(2), uint8(80), uint8(24))
+	f.Add([]byte{iacByte, iacSB, optNAWS, 0, 80, 0, 24, iacByte, iacSE}, uint8(0), uint8(1), uint8(1))
+	f.Add([]byte{'a', iacByte, iacByte, '\r', 0}, uint8(3), uint8(255), uint8(0))
+	f.Add([]byte{iacByte, iacWILL, optNAWS, iacByte, iacDO, 1}, uint8(6), uint8(132), uint8(50))
+	f.Fuzz(func(t *testing.T, data []byte, at, w, h uint8) {
+		// Arbitrary input: one read or byte by byte, same result
+		p1, s1, _ := telRun(data)
+		p2, s2, _ := telRun(bytewise(data)...)
+		if !bytes.Equal(p1, p2) {
+			t.Fatalf("payload whole %q, bytewise %q", p1, p2)
+		}
+		if fmt.Sprint(s1) != fmt.Sprint(s2) {
+			t.Fatalf("subs whole %v, bytewise %v", s1, s2)
+		}
+
+		// data as payload with a NAWS report spliced in: the payload comes
+		// out unchanged and no command bytes leak into it
+		k := int(at) % (len(data) + 1)
+		size := []byte{0, w, 0, h}
+		in := escapeIAC(data[:k])
+		in = append(in, iacByte, iacSB, optNAWS)
+		in = append(in, escapeIAC(size)...)
+		in = append(in, iacByte, iacSE)
+		in = append(in, escapeIAC(data[k:])...)
+		want := stripCRNUL(data)
+		wantSub := []string{fmt.Sprintf("%d:%x", optNAWS, size)}
+		for _, chunks := range [][][]byte{{in}, bytewise(in)} {
+			p, s, _ := telRun(chunks...)
+			if !bytes.Equal(p, want) {
+				t.Fatalf("payload %q, want %q (input %x)", p, want, in)
+			}
+			if fmt.Sprint(s) != fmt.Sprint(wantSub) {
+				t.Fatalf("subs %v, want %v (input %x)", s, wantSub, in)
+			}
+		}
+	})
+}
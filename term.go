@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ── Terminal detection ──
+// TERMINAL-TYPE (RFC 1091) and NEW-ENVIRON (RFC 1572) tell us what the
+// client can display; adaptTerm turns that into a theme, glyph set and
+// output charset.
+
+const (
+	optTTYPE  = 0x18
+	optNEWENV = 0x27
+
+	tIS   = 0
+	tSEND = 1
+	tINFO = 2
+
+	envVAR     = 0
+	envVALUE   = 1
+	envESC     = 2
+	envUSERVAR = 3
+)
+
+// Variables asked for in NEW-ENVIRON SEND, as both VAR and USERVAR since
+// clients disagree on which LANG and COLORTERM are.
+var envWanted = []string{"LANG", "LC_ALL", "LC_CTYPE", "COLORTERM", "USER", "IRCNICK", "IRCALTNICKS"}
+
+type charset int
+
+const (
+	csUTF8 charset = iota
+	csLatin1
+	csASCII
+)
+
+func (c charset) String() string {
+	switch c {
+	case csLatin1:
+		return "latin1"
+	case csASCII:
+		return "ascii"
+	}
+	return "utf8"
+}
+
+// asciiGlyphs replaces the box drawing and arrows used by the layout.
+var asciiGlyphs = map[rune]rune{
+	'│': '|', '─': '-', '»': '>', '▲': '^', '▼': 'v', '→': '>', '←': '<', '✗': 'x',
+}
+
+// encodeRune appends ch to out in the client's charset.
+func encodeRune(out *strings.Builder, cs charset, ch rune) {
+	switch {
+	case cs == csUTF8:
+		out.WriteRune(ch)
+	case ch < 0x80, cs == csLatin1 && ch < 0x100:
+		out.WriteByte(byte(ch))
+	case asciiGlyphs[ch] != 0:
+		out.WriteByte(byte(asciiGlyphs[ch]))
+	default:
+		out.WriteByte('?')
+	}
+}
+
+// decodeInput converts a line typed in a latin1 terminal to UTF-8.
+func decodeInput(cs charset, line string) string {
+	if cs != csLatin1 || utf8.ValidString(line) {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		b.WriteRune(rune(line[i]))
+	}
+	return b.String()
+}
+
+func ttypeSend() []byte {
+	return []byte{iacByte, iacSB, optTTYPE, tSEND, iacByte, iacSE}
+}
+
+func environSend() []byte {
+	b := []byte{iacByte, iacSB, optNEWENV, tSEND}
+	for _, kind := range []byte{envVAR, envUSERVAR} {
+		for _, v := range envWanted {
+			b = append(b, kind)
+			b = append(b, v...)
+		}
+	}
+	return append(b, iacByte, iacSE)
+}
+
+// parseEnviron decodes the variable list of a NEW-ENVIRON IS/INFO.
+func parseEnviron(data []byte) map[string]string {
+	env := make(map[string]string)
+	var name, val []byte
+	inVal, have := false, false
+	flush := func() {
+		if have {
+			env[strings.ToUpper(string(name))] = string(val)
+		}
+		name, val = nil, nil
+		inVal, have = false, false
+	}
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch b {
+		case envVAR, envUSERVAR:
+			flush()
+			have = true
+		case envVALUE:
+			inVal = true
+		case envESC:
+			if i+1 < len(data) {
+				i++
+				if inVal {
+					val = append(val, data[i])
+				} else {
+					name = append(name, data[i])
+				}
+			}
+		default:
+			if inVal {
+				val = append(val, b)
+			} else {
+				name = append(name, b)
+			}
+		}
+	}
+	flush()
+	return env
+}
+
+func (s *Session) setTermType(name string) {
+	s.mu.Lock()
+	if s.term != "" {
+		s.mu.Unlock()
+		return
+	}
+	s.term = strings.ToLower(name)
+	s.adaptTerm()
+	s.mu.Unlock()
+	s.draw()
+}
+
+func (s *Session) setEnv(env map[string]string) {
+	s.mu.Lock()
+	s.gotEnv = true
+	for k, v := range env {
+		if v != "" {
+			s.env[k] = v
+		}
+	}
+	s.adaptTerm()
+	s.mu.Unlock()
+	s.draw()
+}
+
+// adaptTerm picks charset, glyphs and theme from what the client reported.
+// (call with mu held)
+func (s *Session) adaptTerm() {
+	locale := s.env["LC_ALL"]
+	if locale == "" {
+		locale = s.env["LC_CTYPE"]
+	}
+	if locale == "" {
+		locale = s.env["LANG"]
+	}
+	locale = strings.ToLower(locale)
+	switch {
+	case locale == "":
+		// Nothing reported, assume a modern UTF-8 terminal
+	case strings.Contains(locale, "utf-8"), strings.Contains(locale, "utf8"):
+		s.charset = csUTF8
+	case strings.Contains(locale, "8859-1"), strings.Contains(locale, "88591"),
+		strings.Contains(locale, "8859-15"), strings.Contains(locale, "latin1"):
+		s.charset = csLatin1
+	default:
+		s.charset = csASCII
+	}
+
+	if s.themeSet {
+		return
+	}
+	ct := strings.ToLower(s.env["COLORTERM"])
+	switch {
+	case ct == "truecolor" || ct == "24bit":
+		s.theme = themes["nord"]
+	case strings.Contains(s.term, "256color"):
+		s.theme = themes["dark256"]
+	case s.term == "dumb" || s.term == "unknown" || strings.HasPrefix(s.term, "vt"):
+		s.theme = themes["mono"]
+	default:
+		s.theme = themes["default"]
+	}
+}
+
+// termTag describes the detected terminal for the status bar.
+func (s *Session) termTag() string {
+	if s.term == "" {
+		return ""
+	}
+	return s.term + " " + s.charset.String()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ── Themes ──
+// Buffered lines carry role codes (private SGR numbers 200+) instead of
+// literal colors for themeable elements. The renderer resolves them against
+// the session theme, so /theme recolors scrollback as well as the bars.
+
+const (
+	roleTS     = "\033[200m" // timestamps
+	roleJoin   = "\033[201m" // join/part/quit/nick lines
+	roleHL     = "\033[202m" // highlighted lines
+	roleAction = "\033[203m" // /me actions
+	roleNotice = "\033[204m" // -notice- senders
+	roleNickN  = 205         // 205;<hash> — nick from the theme palette
+	roleHidden = "\033[206m" // line prefix: join/part noise the smart filter may hide
+)
+
+type Theme struct {
+	name string
+	mono bool // strip every color, keep attributes
+
+	topbar, status          string
+	ts, joinpart, highlight string
+	action, notice          string
+	sep, prompt, header     string
+	chanActive, chanUnread  string
+	chanIdle, away          string          // away: nicklist entry of an away user
+	prefix                  map[rune]string // ~ & @ % + in the nicklist
+	plain                   string          // nicklist entry without prefix
+	nicks                   []string        // nick hash palette
+}
+
+func fg256(n int) string       { return fmt.Sprintf("\033[38;5;%dm", n) }
+func bg256(n int) string       { return fmt.Sprintf("\033[48;5;%dm", n) }
+func fgRGB(r, g, b int) string { return fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b) }
+func bgRGB(r, g, b int) string { return fmt.Sprintf("\033[48;2;%d;%d;%dm", r, g, b) }
+
+func palette256(codes ...int) []string {
+	p := make([]string, len(codes))
+	for i, c := range codes {
+		p[i] = fg256(c)
+	}
+	return p
+}
+
+var themes = map[string]*Theme{
+	"default": {
+		name:   "default",
+		topbar: bgBlue + fgWhite + bold, status: bgGreen + fgBlack + bold,
+		ts: fgGrey, joinpart: fgGrey, highlight: fgYellow + bold,
+		action: fgMagenta, notice: fgYellow,
+		sep: fgGrey, prompt: fgGreen + bold, header: fgCyan + bold,
+		chanActive: bold + fgWhite, chanUnread: fgCyan, chanIdle: fgGrey,
+		away:   fgGrey + dim,
+		prefix: map[rune]string{'~': fgRed + bold, '&': fgRed, '@': fgGreen, '%': fgCyan, '+': fgYellow},
+		plain:  fgWhite,
+		nicks:  []string{fgRed, fgGreen, fgYellow, fgBlue, fgMagenta, fgCyan},
+	},
+	"dark256": {
+		name:   "dark256",
+		topbar: bg256(24) + fg256(255) + bold, status: bg256(236) + fg256(250),
+		ts: fg256(240), joinpart: fg256(243), highlight: fg256(214) + bold,
+		action: fg256(177), notice: fg256(179),
+		sep: fg256(238), prompt: fg256(114) + bold, header: fg256(110) + bold,
+		chanActive: fg256(255) + bold, chanUnread: fg256(81), chanIdle: fg256(244),
+		away:   fg256(240),
+		prefix: map[rune]string{'~': fg256(203) + bold, '&': fg256(203), '@': fg256(114), '%': fg256(80), '+': fg256(186)},
+		plain:  fg256(252),
+		nicks: palette256(
+			167, 173, 179, 185, 149, 113, 78, 79, 80, 74, 68, 104,
+			140, 176, 175, 174, 209, 215, 221, 191, 155, 120, 86, 87,
+			117, 111, 147, 183, 219, 218, 210, 203,
+		),
+	},
+	"nord": {
+		name:   "nord",
+		topbar: bgRGB(59, 66, 82) + fgRGB(236, 239, 244) + bold, status: bgRGB(67, 76, 94) + fgRGB(216, 222, 233),
+		ts: fgRGB(97, 110, 136), joinpart: fgRGB(118, 130, 155), highlight: fgRGB(235, 203, 139) + bold,
+		action: fgRGB(180, 142, 173), notice: fgRGB(208, 135, 112),
+		sep: fgRGB(67, 76, 94), prompt: fgRGB(163, 190, 140) + bold, header: fgRGB(136, 192, 208) + bold,
+		chanActive: fgRGB(236, 239, 244) + bold, chanUnread: fgRGB(136, 192, 208), chanIdle: fgRGB(118, 130, 155),
+		away: fgRGB(97, 110, 136),
+		prefix: map[rune]string{
+			'~': fgRGB(191, 97, 106) + bold, '&': fgRGB(191, 97, 106), '@': fgRGB(163, 190, 140),
+			'%': fgRGB(143, 188, 187), '+': fgRGB(235, 203, 139),
+		},
+		plain: fgRGB(216, 222, 233),
+		nicks: []string{
+			fgRGB(191, 97, 106), fgRGB(208, 135, 112), fgRGB(235, 203, 139), fgRGB(163, 190, 140),
+			fgRGB(143, 188, 187), fgRGB(136, 192, 208), fgRGB(129, 161, 193), fgRGB(94, 129, 172),
+			fgRGB(180, 142, 173), fgRGB(216, 160, 190), fgRGB(200, 180, 120), fgRGB(120, 190, 160),
+		},
+	},
+	"mono": {
+		name: "mono", mono: true,
+		topbar: "\033[7m" + bold, status: "\033[7m",
+		highlight: bold, sep: "", prompt: bold, header: bold,
+		chanActive: bold + "\033[4m", chanUnread: bold, away: dim,
+		prefix: map[rune]string{'~': bold, '&': bold, '@': bold},
+		nicks:  []string{""},
+	},
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for n := range themes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func nickHash(nick string) int {
+	h := 0
+	for _, c := range nick {
+		h = h*31 + int(c)
+	}
+	if h < 0 {
+		h = -h
+	}
+	if h < 0 { // -MinInt64 overflows
+		h = 0
+	}
+	return h
+}
+
+// nickColor returns the palette role for nick; the color itself is chosen
+// by the theme at render time.
+func nickColor(nick string) string {
+	return fmt.Sprintf("\033[%d;%dm", roleNickN, nickHash(nick))
+}
+
+// prefixColor picks the nicklist color from the highest prefix of n.
+func (t *Theme) prefixColor(n string) string {
+	for _, ch := range n {
+		if c, ok := t.prefix[ch]; ok {
+			return c
+		}
+		break
+	}
+	return t.plain
+}
+
+// resolve maps one SGR sequence from a buffered line to what the client
+// should actually receive under this theme.
+func (t *Theme) resolve(seq string) string {
+	if len(seq) < 3 {
+		return seq
+	}
+	params := strings.Split(seq[2:len(seq)-1], ";")
+	switch params[0] {
+	case "200":
+		return t.ts
+	case "201":
+		return t.joinpart
+	case "202":
+		return t.highlight
+	case "203":
+		return t.action
+	case "204":
+		return t.notice
+	case "206":
+		return ""
+	case "205":
+		if len(params) > 1 {
+			n := len(t.nicks)
+			return t.nicks[(simpleAtoi(params[1])%n+n)%n]
+		}
+		return t.nicks[0]
+	}
+	if !t.mono {
+		return seq
+	}
+	var keep []string
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case "38", "48": // extended color: skip 5;n or 2;r;g;b
+			if i+1 < len(params) && params[i+1] == "5" {
+				i += 2
+			} else if i+1 < len(params) && params[i+1] == "2" {
+				i += 4
+			}
+		case "0", "1", "2", "4", "7", "22", "24", "27":
+			keep = append(keep, params[i])
+		}
+	}
+	if len(keep) == 0 {
+		return ""
+	}
+	return "\033[" + strings.Join(keep, ";") + "m"
+}
+
+// cmdTheme lists the themes or switches to one. (call without mu held)
+func (s *Session) cmdTheme(arg string) {
+	s.mu.Lock()
+	ac := s.activeChan()
+	name := strings.ToLower(strings.TrimSpace(arg))
+	if name == "" {
+		var list []string
+		for _, n := range themeNames() {
+			if n == s.theme.name {
+				n = fgWhite + bold + n + rst + fgGrey
+			}
+			list = append(list, n)
+		}
+		ac.addMsg(s.fmtMsg(fgGrey + "Themes: " + strings.Join(list, ", ") + rst))
+	} else if t, ok := themes[name]; ok {
+		s.theme = t
+		s.themeSet = true
+		ac.addMsg(s.fmtMsg(fgGrey + "Theme set to " + fgWhite + bold + t.name + rst))
+	} else {
+		ac.addMsg(s.fmtMsg(fgGrey+"Unknown theme "+fgWhite+"%s"+fgGrey+". Try /theme"+rst, name))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
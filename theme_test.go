@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+// Role codes in a buffered line must never index outside the nick palette,
+// whatever number follows them.
+func TestResolveNickIndex(t *testing.T) {
+	for _, seq := range []string{"\033[205m", "\033[205;3m", "\033[205;9223372036854775808m", "\033[205;18446744073709551615m"} {
+		for _, th := range themes {
+			th.resolve(seq)
+		}
+	}
+}
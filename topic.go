@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// ── Topic ──
+// 332/333 on join, live TOPIC changes and 329 creation time, plus a short
+// per-channel history for /topic -h.
+
+const maxTopics = 50
+
+type topicChange struct {
+	text, by string
+	at       time.Time
+}
+
+// recordTopic appends to c's history unless it repeats the last entry, in
+// which case a missing setter is filled in. (call with mu held)
+func (c *Channel) recordTopic(text, by string, at time.Time) {
+	if n := len(c.topics); n > 0 && c.topics[n-1].text == text {
+		if c.topics[n-1].by == "" {
+			c.topics[n-1].by, c.topics[n-1].at = by, at
+		}
+		return
+	}
+	c.topics = append(c.topics, topicChange{text, by, at})
+	if len(c.topics) > maxTopics {
+		c.topics = c.topics[len(c.topics)-maxTopics:]
+	}
+}
+
+// topicReply handles 332 RPL_TOPIC and 331 RPL_NOTOPIC. (call without mu held)
+func (s *Session) topicReply(m ircMsg) {
+	if len(m.params) < 2 {
+		return
+	}
+	s.mu.Lock()
+	if c := s.getChan(m.params[1]); c != nil {
+		if m.command == "331" {
+			c.topic, c.topicBy, c.topicAt = "", "", time.Time{}
+			s.addMsgTo(c, s.fmtMsg(fgGrey+"No topic is set"+rst))
+		} else {
+			// 333 fills in who and when, if the server sends it
+			c.topic, c.topicBy, c.topicAt = m.trail(), "", time.Time{}
+			c.recordTopic(c.topic, "", time.Time{})
+			s.addMsgTo(c, s.fmtMsg(fgGrey+"Topic: "+rst+"%s", c.topic))
+		}
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// topicWhoTime handles 333 RPL_TOPICWHOTIME. (call without mu held)
+func (s *Session) topicWhoTime(m ircMsg) {
+	// me channel setter time
+	if len(m.params) < 4 {
+		return
+	}
+	s.mu.Lock()
+	if c := s.getChan(m.params[1]); c != nil {
+		c.topicBy = m.params[2]
+		if i := strings.IndexByte(c.topicBy, '!'); i > 0 {
+			c.topicBy = c.topicBy[:i]
+		}
+		c.topicAt = time.Unix(int64(simpleAtoi(m.params[3])), 0)
+		c.recordTopic(c.topic, c.topicBy, c.topicAt)
+		s.addMsgTo(c, s.fmtMsg(fgGrey+"Set by "+rst+"%s"+fgGrey+" on %s"+rst, c.topicBy, c.topicAt.Format("2006-01-02 15:04")))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// creationTime stores 329 RPL_CREATIONTIME. It follows every MODE query, so
+// it's kept quiet. (call without mu held)
+func (s *Session) creationTime(m ircMsg) {
+	if len(m.params) < 3 {
+		return
+	}
+	s.mu.Lock()
+	if c := s.getChan(m.params[1]); c != nil {
+		c.created = time.Unix(int64(simpleAtoi(m.params[2])), 0)
+	}
+	s.mu.Unlock()
+}
+
+// topicChanged handles a live TOPIC from anyone, us included.
+// (call without mu held)
+func (s *Session) topicChanged(m ircMsg) {
+	if len(m.params) < 1 {
+		return
+	}
+	who := m.nick()
+	text := ""
+	if len(m.params) >= 2 {
+		text = m.trail()
+	}
+	s.mu.Lock()
+	if c := s.getChan(m.params[0]); c != nil {
+		c.topic, c.topicBy, c.topicAt = text, who, time.Now()
+		c.recordTopic(text, who, c.topicAt)
+		if text == "" {
+			s.addMsgTo(c, s.fmtMsg(nickColor(who)+"%s"+rst+fgGrey+" cleared the topic"+rst, who))
+		} else {
+			s.addMsgTo(c, s.fmtMsg(nickColor(who)+"%s"+rst+fgGrey+" changed the topic to: "+rst+"%s", who, text))
+		}
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// topicHistory prints what's known about the active channel's topics.
+// (call without mu held)
+func (s *Session) topicHistory() {
+	s.mu.Lock()
+	c := s.activeChan()
+	s.addMsgTo(c, s.fmtMsg(fgCyan+bold+"── Topic history %s ──"+rst, c.name))
+	if !c.created.IsZero() {
+		s.addMsgTo(c, s.fmtMsg(fgGrey+" created   %s"+rst, c.created.Format("2006-01-02 15:04")))
+	}
+	if len(c.topics) == 0 {
+		s.addMsgTo(c, s.fmtMsg(fgGrey+" no topic seen yet"+rst))
+	}
+	for _, t := range c.topics {
+		when, by := "unknown", t.by
+		if !t.at.IsZero() {
+			when = t.at.Format("2006-01-02 15:04")
+		}
+		if by == "" {
+			by = "?"
+		}
+		text := t.text
+		if text == "" {
+			text = fgGrey + "(cleared)" + rst
+		}
+		s.addMsgTo(c, s.fmtMsg(fgGrey+" %s "+rst+nickColor(by)+"%-12s"+rst+" %s", when, by, text))
+	}
+	s.addMsgTo(c, s.fmtMsg(fgCyan+"── end of topic history ──"+rst))
+	s.mu.Unlock()
+	s.draw()
+}
@@ -0,0 +1,52 @@
+package main
+
+import "strings"
+
+// ── User cache ──
+// user@host for every nick seen in a prefix or WHO/WHOIS reply, used to
+// build ban masks, plus away state.
+
+type ircUser struct {
+	nick, user, host string
+	away             bool
+	awayMsg          string
+	awayShown        string // last 301 message printed
+}
+
+// seenPrefix records nick!user@host from a message prefix. (call with mu held)
+func (s *Session) seenPrefix(prefix string) {
+	nick, uh, ok := strings.Cut(prefix, "!")
+	if !ok {
+		return
+	}
+	user, host, ok := strings.Cut(uh, "@")
+	if !ok {
+		return
+	}
+	s.seenUser(nick, user, host)
+}
+
+// seenUser records one user. (call with mu held)
+func (s *Session) seenUser(nick, user, host string) *ircUser {
+	u := s.users[strings.ToLower(nick)]
+	if u == nil {
+		u = &ircUser{}
+		s.users[strings.ToLower(nick)] = u
+	}
+	u.nick, u.user, u.host = nick, user, host
+	return u
+}
+
+// user returns the cached entry for nick, or nil. (call with mu held)
+func (s *Session) user(nick string) *ircUser {
+	return s.users[strings.ToLower(nick)]
+}
+
+// renameUser follows a NICK change. (call with mu held)
+func (s *Session) renameUser(old, nick string) {
+	if u := s.users[strings.ToLower(old)]; u != nil {
+		delete(s.users, strings.ToLower(old))
+		u.nick = nick
+		s.users[strings.ToLower(nick)] = u
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// ── WHOIS / WHOWAS / WHO ──
+// The reply numerics are collected into one result per request and printed
+// as a block in the window the command was typed in.
+
+type whoisResult struct {
+	nick, user, host, realname string
+	server, serverInfo         string
+	channels                   []string
+	idle                       time.Duration
+	signon                     time.Time
+	account                    string
+	actual                     string
+	away                       string
+	oper, secure               bool
+	extra                      []string // numerics without a dedicated field
+	whowas                     bool
+	ch                         *Channel // window to print into
+}
+
+type whoReq struct {
+	mask   string
+	rows   [][4]string // nick, user@host, flags, realname
+	ch     *Channel
+	silent bool // internal request, don't print
+}
+
+// whoisFor returns the pending result for nick, starting one that prints to
+// the active window if the server sent it unasked. (call with mu held)
+func (s *Session) whoisFor(nick string, whowas bool) *whoisResult {
+	key := strings.ToLower(nick)
+	if r, ok := s.whois[key]; ok {
+		return r
+	}
+	r := &whoisResult{nick: nick, whowas: whowas, ch: s.activeChan()}
+	s.whois[key] = r
+	return r
+}
+
+func (s *Session) cmdWhois(arg string, whowas bool) {
+	nick := strings.TrimSpace(arg)
+	if nick == "" {
+		return
+	}
+	nick = strings.Fields(nick)[0]
+	s.mu.Lock()
+	r := &whoisResult{nick: nick, whowas: whowas, ch: s.activeChan()}
+	s.whois[strings.ToLower(nick)] = r
+	s.mu.Unlock()
+	if whowas {
+		s.ircSend("WHOWAS " + nick)
+	} else {
+		s.ircSend("WHOIS " + nick + " " + nick) // ask the user's server, for idle time
+	}
+}
+
+func (s *Session) cmdWho(arg string) {
+	mask := strings.TrimSpace(arg)
+	s.mu.Lock()
+	if mask == "" {
+		mask = s.activeChan().name
+	}
+	s.whoQ = append(s.whoQ, &whoReq{mask: mask, ch: s.activeChan()})
+	s.mu.Unlock()
+	s.ircSend("WHO " + mask)
+}
+
+// whoisNumeric files one reply line into its result. (call without mu held)
+func (s *Session) whoisNumeric(m ircMsg) {
+	if len(m.params) < 2 {
+		return
+	}
+	p := m.params
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.whoisFor(p[1], m.command == "314")
+	switch m.command {
+	case "311", "314": // RPL_WHOISUSER, RPL_WHOWASUSER
+		if len(p) >= 6 {
+			r.nick, r.user, r.host, r.realname = p[1], p[2], p[3], p[5]
+			if m.command == "311" {
+				s.seenUser(p[1], p[2], p[3])
+			}
+		}
+	case "312": // RPL_WHOISSERVER
+		if len(p) >= 3 {
+			r.server = p[2]
+			if len(p) >= 4 {
+				r.serverInfo = p[3]
+			}
+		}
+	case "313": // RPL_WHOISOPERATOR
+		r.oper = true
+	case "317": // RPL_WHOISIDLE
+		if len(p) >= 3 {
+			r.idle = time.Duration(simpleAtoi(p[2])) * time.Second
+			if len(p) >= 5 {
+				r.signon = time.Unix(int64(simpleAtoi(p[3])), 0)
+			}
+		}
+	case "319": // RPL_WHOISCHANNELS
+		r.channels = append(r.channels, strings.Fields(m.trail())...)
+	case "330": // RPL_WHOISACCOUNT
+		if len(p) >= 3 {
+			r.account = p[2]
+		}
+	case "338": // RPL_WHOISACTUALLY
+		if len(p) >= 3 {
+			r.actual = strings.Join(p[2:len(p)-1], " ")
+		}
+	case "671": // RPL_WHOISSECURE
+		r.secure = true
+	case "301": // RPL_AWAY
+		r.away = m.trail()
+	default:
+		r.extra = append(r.extra, m.trail())
+	}
+}
+
+// whoisEnd prints the collected result on 318/369. (call without mu held)
+func (s *Session) whoisEnd(m ircMsg) {
+	if len(m.params) < 2 {
+		return
+	}
+	s.mu.Lock()
+	key := strings.ToLower(m.params[1])
+	r, ok := s.whois[key]
+	delete(s.whois, key)
+	if ok {
+		s.printWhois(r)
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// whoisError ends a pending lookup on 401/406; reports whether one was
+// pending. (call without mu held)
+func (s *Session) whoisError(m ircMsg) bool {
+	if len(m.params) < 2 {
+		return false
+	}
+	s.mu.Lock()
+	key := strings.ToLower(m.params[1])
+	r, ok := s.whois[key]
+	if ok {
+		delete(s.whois, key)
+		r.ch.addMsg(s.fmtMsg(fgRed+"%s"+rst+fgGrey+": %s"+rst, m.params[1], m.trail()))
+	}
+	s.mu.Unlock()
+	s.draw()
+	return ok
+}
+
+// printWhois renders r as a block. (call with mu held)
+func (s *Session) printWhois(r *whoisResult) {
+	title := "WHOIS"
+	if r.whowas {
+		title = "WHOWAS"
+	}
+	row := func(label, format string, args ...interface{}) {
+		s.addMsgTo(r.ch, s.fmtMsg(fgGrey+" %-9s"+rst+" "+format, append([]interface{}{label}, args...)...))
+	}
+	s.addMsgTo(r.ch, s.fmtMsg(fgCyan+bold+"── %s %s ──"+rst, title, r.nick))
+	if r.user != "" {
+		row("user", nickColor(r.nick)+"%s"+rst+" (%s@%s)", r.nick, r.user, r.host)
+		row("realname", "%s", r.realname)
+	}
+	if r.actual != "" {
+		row("actually", "%s", r.actual)
+	}
+	if len(r.channels) > 0 {
+		row("channels", "%s", strings.Join(r.channels, " "))
+	}
+	if r.server != "" {
+		label := "server"
+		if r.whowas {
+			label = "last seen"
+		}
+		row(label, "%s "+fgGrey+"(%s)"+rst, r.server, r.serverInfo)
+	}
+	if r.account != "" {
+		row("account", "%s", r.account)
+	}
+	if r.idle > 0 || !r.signon.IsZero() {
+		row("idle", "%s", r.idle)
+		if !r.signon.IsZero() {
+			row("signon", "%s", r.signon.Format("2006-01-02 15:04:05"))
+		}
+	}
+	if r.secure {
+		row("tls", "secure connection")
+	}
+	if r.oper {
+		row("oper", "IRC operator")
+	}
+	if r.away != "" {
+		row("away", "%s", r.away)
+	}
+	for _, e := range r.extra {
+		row("", "%s", e)
+	}
+	s.addMsgTo(r.ch, s.fmtMsg(fgCyan+"── end of %s ──"+rst, strings.ToLower(title)))
+}
+
+// whoReply adds one 352 row to the oldest pending WHO. (call without mu held)
+func (s *Session) whoReply(m ircMsg) {
+	// me channel user host server nick flags :hops realname
+	if len(m.params) < 8 {
+		return
+	}
+	p := m.params
+	realname := m.trail()
+	if _, rest, ok := strings.Cut(realname, " "); ok {
+		realname = rest
+	}
+	s.mu.Lock()
+	u := s.seenUser(p[5], p[2], p[3])
+	u.away = strings.HasPrefix(p[6], "G")
+	row := [4]string{p[5], p[2] + "@" + p[3], p[6], realname}
+	if len(s.whoQ) > 0 {
+		q := s.whoQ[0]
+		q.rows = append(q.rows, row)
+		s.mu.Unlock()
+		return
+	}
+	// Not ours (e.g. /quote WHO): show it as it comes
+	s.serverCh.addMsg(s.whoRow(row))
+	s.mu.Unlock()
+	s.draw()
+}
+
+// whoRow formats one WHO reply row. (call with mu held)
+func (s *Session) whoRow(r [4]string) string {
+	return s.fmtMsg(" "+nickColor(r[0])+"%-16s"+rst+" %-5s "+fgGrey+"%s"+rst+" %s", r[0], r[2], r[1], r[3])
+}
+
+// whoEnd prints the oldest pending WHO on 315. (call without mu held)
+func (s *Session) whoEnd(m ircMsg) {
+	s.mu.Lock()
+	if len(s.whoQ) == 0 {
+		if len(m.params) > 1 {
+			s.serverCh.addMsg(s.fmtMsg(fgCyan+"── end of who %s ──"+rst, m.params[1]))
+		}
+		s.mu.Unlock()
+		s.draw()
+		return
+	}
+	q := s.whoQ[0]
+	s.whoQ = s.whoQ[1:]
+	if !q.silent {
+		s.addMsgTo(q.ch, s.fmtMsg(fgCyan+bold+"── WHO %s ── "+rst+fgGrey+"%d found"+rst, q.mask, len(q.rows)))
+		for _, r := range q.rows {
+			s.addMsgTo(q.ch, s.whoRow(r))
+		}
+		s.addMsgTo(q.ch, s.fmtMsg(fgCyan+"── end of who ──"+rst))
+	}
+	s.mu.Unlock()
+	s.draw()
+}
+
+// whoisPending reports whether a WHOIS for nick is being collected, so a
+// 301 away reply belongs to it. (call with mu held)
+func (s *Session) whoisPending(nick string) bool {
+	_, ok := s.whois[strings.ToLower(nick)]
+	return ok
+}